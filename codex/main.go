@@ -71,6 +71,8 @@ import (
 	voronoi "codex/pkg/grid_voronoi"
 	"codex/pkg/crafting"
 	"codex/pkg/helpers"
+	"fmt"
+	"math/rand"
 	"sync"
 	"codex/pkg/storage"
 )
@@ -264,6 +266,8 @@ func InventoryIsSlotEmpty(invID, slotIdx C.int) C.bool {
 	return C.bool(slot == nil || slot.Quantity == 0)
 }
 
+// EquipmentDefineSlot fails rather than shrink a slot over equipped items;
+// Equipment_ResizeSlot evicts them
 //export EquipmentDefineSlot
 func EquipmentDefineSlot(slotType *C.char, maxSlots C.int) C.int {
 	if equipment.GetManager().DefineSlot(C.GoString(slotType), int(maxSlots)) {
@@ -342,6 +346,394 @@ func EquipmentClear() {
 	equipment.Clear()
 }
 
+// Equipment_* functions address a manager by the ID returned from
+// Equipment_New; ID 0 is the global manager used by the functions above.
+
+//export Equipment_New
+func Equipment_New() C.int {
+	return C.int(equipment.NewManagerInstance())
+}
+
+//export Equipment_Free
+func Equipment_Free(managerID C.int) C.bool {
+	return C.bool(equipment.RemoveInstance(int(managerID)))
+}
+
+// Equipment_DefineSlot fails rather than shrink a slot over equipped items;
+// Equipment_ResizeSlot evicts them
+//export Equipment_DefineSlot
+func Equipment_DefineSlot(managerID C.int, slotType *C.char, maxSlots C.int) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.DefineSlot(C.GoString(slotType), int(maxSlots)))
+}
+
+// Equipment_ResizeSlot returns an iterator handle over the items evicted by
+// shrinking the slot, or 0 if the manager doesn't exist or maxSlots is invalid
+//export Equipment_ResizeSlot
+func Equipment_ResizeSlot(managerID C.int, slotType *C.char, maxSlots C.int) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	evicted, ok := em.ResizeSlot(C.GoString(slotType), int(maxSlots))
+	if !ok {
+		return 0
+	}
+	return C.int(equipment.OpenListIter(evicted))
+}
+
+//export Equipment_EquipAt
+func Equipment_EquipAt(managerID C.int, slotType *C.char, index C.int, itemID *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.int(equipment.EquipUnknownSlot)
+	}
+	return C.int(em.EquipAt(C.GoString(slotType), int(index), C.GoString(itemID)))
+}
+
+//export Equipment_GetAt
+func Equipment_GetAt(managerID C.int, slotType *C.char, index C.int) *C.char {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.CString("")
+	}
+	return C.CString(em.GetAt(C.GoString(slotType), int(index)))
+}
+
+//export Equipment_UnequipAt
+func Equipment_UnequipAt(managerID C.int, slotType *C.char, index C.int) *C.char {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.CString("")
+	}
+	return C.CString(em.UnequipAt(C.GoString(slotType), int(index)))
+}
+
+//export Equipment_SwapWithin
+func Equipment_SwapWithin(managerID C.int, slotType *C.char, i C.int, j C.int) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.SwapWithin(C.GoString(slotType), int(i), int(j)))
+}
+
+//export Equipment_RemoveSlotDefinition
+func Equipment_RemoveSlotDefinition(managerID C.int, slotType *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.RemoveSlotDefinition(C.GoString(slotType)))
+}
+
+//export Equipment_EquipItem
+func Equipment_EquipItem(managerID C.int, slotType *C.char, itemID *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.EquipItem(C.GoString(slotType), C.GoString(itemID)))
+}
+
+// Equipment_TryEquip equips an item and returns 0 on success or an
+// equipment.EquipResult reason code on failure
+//export Equipment_TryEquip
+func Equipment_TryEquip(managerID C.int, slotType *C.char, itemID *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.int(equipment.EquipUnknownSlot)
+	}
+	return C.int(em.Equip(C.GoString(slotType), C.GoString(itemID)))
+}
+
+//export Equipment_EquipFromInventory
+func Equipment_EquipFromInventory(managerID C.int, invID C.int, slotIdx C.int, slotType *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.int(equipment.EquipUnknownSlot)
+	}
+	inv := inventory.GetInventory(int(invID))
+	if inv == nil {
+		return C.int(equipment.EquipNotInInventory)
+	}
+	return C.int(em.EquipFromInventory(inv, int(slotIdx), C.GoString(slotType)))
+}
+
+//export Equipment_UnequipToInventory
+func Equipment_UnequipToInventory(managerID C.int, slotType *C.char, itemID *C.char, invID C.int) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.int(equipment.EquipUnknownSlot)
+	}
+	inv := inventory.GetInventory(int(invID))
+	if inv == nil {
+		return C.int(equipment.EquipNoRoom)
+	}
+	return C.int(em.UnequipToInventory(C.GoString(slotType), C.GoString(itemID), inv))
+}
+
+// Equipment_ApplyWear returns an iterator handle over the items that broke,
+// or 0 if the manager doesn't exist
+//export Equipment_ApplyWear
+func Equipment_ApplyWear(managerID C.int, slotType *C.char, amount C.double) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	broken := em.ApplyWear(C.GoString(slotType), float64(amount))
+	return C.int(equipment.OpenListIter(broken))
+}
+
+//export Equipment_ApplyItemWear
+func Equipment_ApplyItemWear(managerID C.int, itemID *C.char, amount C.double) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.ApplyItemWear(C.GoString(itemID), float64(amount)))
+}
+
+//export Equipment_GetDurability
+func Equipment_GetDurability(managerID C.int, itemID *C.char) C.double {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	return C.double(em.Durability(C.GoString(itemID)))
+}
+
+//export Equipment_IsBroken
+func Equipment_IsBroken(managerID C.int, itemID *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.IsBroken(C.GoString(itemID)))
+}
+
+//export Equipment_RepairFromInventory
+func Equipment_RepairFromInventory(managerID C.int, itemID *C.char, invID C.int) C.int {
+	em := equipment.GetInstance(int(managerID))
+	inv := inventory.GetInventory(int(invID))
+	if em == nil || inv == nil {
+		return C.int(equipment.RepairCannotAfford)
+	}
+	return C.int(em.Repair(C.GoString(itemID), crafting.InventoryStock{Inv: inv}))
+}
+
+//export Equipment_ApplyWearAt
+func Equipment_ApplyWearAt(managerID C.int, slotType *C.char, index C.int, amount C.double) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.ApplyWearAt(C.GoString(slotType), int(index), float64(amount)))
+}
+
+//export Equipment_GetDurabilityAt
+func Equipment_GetDurabilityAt(managerID C.int, slotType *C.char, index C.int) C.double {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	return C.double(em.DurabilityAt(C.GoString(slotType), int(index)))
+}
+
+//export Equipment_IsBrokenAt
+func Equipment_IsBrokenAt(managerID C.int, slotType *C.char, index C.int) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.IsBrokenAt(C.GoString(slotType), int(index)))
+}
+
+//export Equipment_RepairAtFromInventory
+func Equipment_RepairAtFromInventory(managerID C.int, slotType *C.char, index C.int, invID C.int) C.int {
+	em := equipment.GetInstance(int(managerID))
+	inv := inventory.GetInventory(int(invID))
+	if em == nil || inv == nil {
+		return C.int(equipment.RepairCannotAfford)
+	}
+	return C.int(em.RepairAt(C.GoString(slotType), int(index), crafting.InventoryStock{Inv: inv}))
+}
+
+//export Equipment_CanEquip
+func Equipment_CanEquip(managerID C.int, slotType *C.char, itemID *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.int(equipment.EquipUnknownSlot)
+	}
+	return C.int(em.CanEquip(C.GoString(slotType), C.GoString(itemID)))
+}
+
+//export Equipment_UnequipItem
+func Equipment_UnequipItem(managerID C.int, slotType *C.char, itemID *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.UnequipItem(C.GoString(slotType), C.GoString(itemID)))
+}
+
+//export Equipment_IsSlotFull
+func Equipment_IsSlotFull(managerID C.int, slotType *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.IsSlotFull(C.GoString(slotType)))
+}
+
+//export Equipment_IsItemEquipped
+func Equipment_IsItemEquipped(managerID C.int, slotType *C.char, itemID *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.IsItemEquipped(C.GoString(slotType), C.GoString(itemID)))
+}
+
+//export Equipment_ClearSlot
+func Equipment_ClearSlot(managerID C.int, slotType *C.char) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	return C.bool(em.ClearSlot(C.GoString(slotType)))
+}
+
+//export Equipment_GetSlotAvailability
+func Equipment_GetSlotAvailability(managerID C.int, slotType *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	return C.int(em.GetSlotAvailability(C.GoString(slotType)))
+}
+
+//export Equipment_Clear
+func Equipment_Clear(managerID C.int) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	em.Clear()
+	return true
+}
+
+//export Equipment_CopyLoadout
+func Equipment_CopyLoadout(fromID C.int, toID C.int) C.bool {
+	from := equipment.GetInstance(int(fromID))
+	to := equipment.GetInstance(int(toID))
+	if from == nil || to == nil {
+		return false
+	}
+	to.CopyLoadoutFrom(from)
+	return true
+}
+
+//export Equipment_SwapLoadouts
+func Equipment_SwapLoadouts(aID C.int, bID C.int) C.bool {
+	a := equipment.GetInstance(int(aID))
+	b := equipment.GetInstance(int(bID))
+	if a == nil || b == nil {
+		return false
+	}
+	equipment.SwapLoadouts(a, b)
+	return true
+}
+
+//export EquipmentGetStat
+func EquipmentGetStat(name *C.char) C.double {
+	return C.double(equipment.GetManager().GetStat(C.GoString(name)))
+}
+
+//export Equipment_GetStat
+func Equipment_GetStat(managerID C.int, name *C.char) C.double {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	return C.double(em.GetStat(C.GoString(name)))
+}
+
+//export Equipment_SetBaseStat
+func Equipment_SetBaseStat(managerID C.int, name *C.char, value C.double) C.bool {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return false
+	}
+	em.SetBaseStat(C.GoString(name), float64(value))
+	return true
+}
+
+//export Equipment_GetSetPieces
+func Equipment_GetSetPieces(managerID C.int, setID *C.char) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	return C.int(em.SetPieces(C.GoString(setID)))
+}
+
+// Equipment_PollSetEvent pops the next set bonus change: the tier's piece count
+// when activated, its negation when deactivated, or 0 when nothing happened.
+// Equipment_LastSetEventID then names the set.
+//export Equipment_PollSetEvent
+func Equipment_PollSetEvent(managerID C.int) C.int {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return 0
+	}
+	ev, ok := em.PollSetEvent()
+	if !ok {
+		return 0
+	}
+	if ev.Activated {
+		return C.int(ev.Pieces)
+	}
+	return C.int(-ev.Pieces)
+}
+
+//export Equipment_LastSetEventID
+func Equipment_LastSetEventID(managerID C.int) *C.char {
+	em := equipment.GetInstance(int(managerID))
+	if em == nil {
+		return C.CString("")
+	}
+	return C.CString(em.LastSetEvent().SetID)
+}
+
+//export Equipment_OpenActiveSetsIter
+func Equipment_OpenActiveSetsIter(managerID C.int) C.int {
+	return C.int(equipment.OpenActiveSetsIter(int(managerID)))
+}
+
+//export Equipment_OpenItemsIter
+func Equipment_OpenItemsIter(managerID C.int) C.int {
+	return C.int(equipment.OpenItemsIter(int(managerID)))
+}
+
+//export Equipment_OpenSlotsIter
+func Equipment_OpenSlotsIter(managerID C.int) C.int {
+	return C.int(equipment.OpenSlotsIter(int(managerID)))
+}
+
+//export Equipment_IterNext
+func Equipment_IterNext(handle C.int) *C.char {
+	return C.CString(equipment.IterNext(int(handle)))
+}
+
+//export Equipment_CloseIter
+func Equipment_CloseIter(handle C.int) {
+	equipment.CloseIter(int(handle))
+}
+
 func Metrics_IncInt(name *C.char) {
 	metrics.IncInt(C.GoString(name))
 }
@@ -453,9 +845,90 @@ func Store_RandomSelect(prefix *C.char) *C.char {
 	return C.CString(res)
 }
 
+// Store_Seed restarts the store's random generator so draws repeat
+//export Store_Seed
+func Store_Seed(seed C.longlong) {
+	store.GetStore().Seed(int64(seed))
+}
+
+// Store_OpenSelectIter draws count names from the children of prefix and
+// returns a handle over them, read with Store_IterNext. unique draws without
+// replacement; modifier names a key scaling each weight, such as
+// "player.luck" or "{child}.luck_bonus", or is empty.
+//export Store_OpenSelectIter
+func Store_OpenSelectIter(prefix *C.char, count C.int, unique C.bool, modifier *C.char) C.int {
+	return C.int(store.OpenIter(store.GetStore().Select(C.GoString(prefix), selectOptions(count, unique, modifier))))
+}
+
+// Store_OpenSeededSelectIter is Store_OpenSelectIter drawing from its own
+// generator started from seed
+//export Store_OpenSeededSelectIter
+func Store_OpenSeededSelectIter(prefix *C.char, count C.int, unique C.bool, modifier *C.char, seed C.longlong) C.int {
+	opts := selectOptions(count, unique, modifier)
+	opts.Rand = rand.New(rand.NewSource(int64(seed)))
+	return C.int(store.OpenIter(store.GetStore().Select(C.GoString(prefix), opts)))
+}
+
+func selectOptions(count C.int, unique C.bool, modifier *C.char) store.SelectOptions {
+	opts := store.SelectOptions{Count: int(count), Unique: bool(unique)}
+	if mod := C.GoString(modifier); mod != "" {
+		opts.Modifiers = []string{mod}
+	}
+	return opts
+}
+
+// ---- Errors and schema ----
+// Store writes return false when the store's schema rejects them, and
+// subtractions also when the value is too small; Store_LastError then
+// describes why. Writes that may find nothing to do, like Store_RemoveString,
+// return false with an empty Store_LastError in that case.
+
+var (
+	storeErrMu sync.Mutex
+	storeErr   string
+)
+
+// storeResult records err for Store_LastError and reports whether it is nil
+func storeResult(err error) C.bool {
+	storeErrMu.Lock()
+	defer storeErrMu.Unlock()
+	if err != nil {
+		storeErr = err.Error()
+		return false
+	}
+	storeErr = ""
+	return true
+}
+
+// storeFound records err like storeResult and reports whether the write
+// found something to do and succeeded
+func storeFound(found bool, err error) C.bool {
+	return storeResult(err) && C.bool(found)
+}
+
+// Store_LastError returns the error of the last store call that reports
+// one, or "" if it succeeded
+//export Store_LastError
+func Store_LastError() *C.char {
+	storeErrMu.Lock()
+	defer storeErrMu.Unlock()
+	return C.CString(storeErr) // caller must free
+}
+
+// Store_LoadSchema applies a schema written in YAML or JSON
+//export Store_LoadSchema
+func Store_LoadSchema(text *C.char) C.bool {
+	return storeResult(store.GetStore().LoadSchema([]byte(C.GoString(text))))
+}
+
+//export Store_ClearSchema
+func Store_ClearSchema() {
+	store.GetStore().SetSchema(nil)
+}
+
 //export Store_SetInt
-func Store_SetInt(key *C.char, val C.longlong) {
-	store.GetStore().SetInt(C.GoString(key), int64(val))
+func Store_SetInt(key *C.char, val C.longlong) C.bool {
+	return storeResult(store.GetStore().SetInt(C.GoString(key), int64(val)))
 }
 
 //export Store_GetInt
@@ -464,20 +937,20 @@ func Store_GetInt(key *C.char) C.longlong {
 }
 
 //export Store_AddInt
-func Store_AddInt(key *C.char, val C.longlong) {
-	store.GetStore().AddInt(C.GoString(key), int64(val))
+func Store_AddInt(key *C.char, val C.longlong) C.bool {
+	return storeResult(store.GetStore().AddInt(C.GoString(key), int64(val)))
 }
 
 //export Store_SubInt
 func Store_SubInt(key *C.char, val C.longlong) C.bool {
-	return C.bool(store.GetStore().SubInt(C.GoString(key), int64(val)))
+	return storeResult(store.GetStore().SubInt(C.GoString(key), int64(val)))
 }
 
 // ---- Float ----
 
 //export Store_SetFloat
-func Store_SetFloat(key *C.char, val C.double) {
-	store.GetStore().SetFloat(C.GoString(key), float64(val))
+func Store_SetFloat(key *C.char, val C.double) C.bool {
+	return storeResult(store.GetStore().SetFloat(C.GoString(key), float64(val)))
 }
 
 //export Store_GetFloat
@@ -486,20 +959,20 @@ func Store_GetFloat(key *C.char) C.double {
 }
 
 //export Store_AddFloat
-func Store_AddFloat(key *C.char, val C.double) {
-	store.GetStore().AddFloat(C.GoString(key), float64(val))
+func Store_AddFloat(key *C.char, val C.double) C.bool {
+	return storeResult(store.GetStore().AddFloat(C.GoString(key), float64(val)))
 }
 
 //export Store_SubFloat
 func Store_SubFloat(key *C.char, val C.double) C.bool {
-	return C.bool(store.GetStore().SubFloat(C.GoString(key), float64(val)))
+	return storeResult(store.GetStore().SubFloat(C.GoString(key), float64(val)))
 }
 
 // ---- Bool ----
 
 //export Store_SetBool
-func Store_SetBool(key *C.char, val C.bool) {
-	store.GetStore().SetBool(C.GoString(key), bool(val))
+func Store_SetBool(key *C.char, val C.bool) C.bool {
+	return storeResult(store.GetStore().SetBool(C.GoString(key), bool(val)))
 }
 
 //export Store_GetBool
@@ -509,14 +982,14 @@ func Store_GetBool(key *C.char) C.bool {
 
 //export Store_ReleaseBool
 func Store_ReleaseBool(key *C.char) C.bool {
-	return C.bool(store.GetStore().ReleaseBool(C.GoString(key)))
+	return storeFound(store.GetStore().ReleaseBool(C.GoString(key)))
 }
 
 // ---- String ----
 
 //export Store_SetString
-func Store_SetString(key *C.char, val *C.char) {
-	store.GetStore().SetString(C.GoString(key), C.GoString(val))
+func Store_SetString(key *C.char, val *C.char) C.bool {
+	return storeResult(store.GetStore().SetString(C.GoString(key), C.GoString(val)))
 }
 
 //export Store_GetString
@@ -525,6 +998,271 @@ func Store_GetString(key *C.char) *C.char {
 	return C.CString(s) // caller must free
 }
 
+// ---- Formulas ----
+
+// Store_SetFormula stores an expression read through Store_GetFloat and
+// Store_GetInt; returns false if it doesn't parse or would form a cycle
+//export Store_SetFormula
+func Store_SetFormula(key *C.char, expr *C.char) C.bool {
+	return storeResult(store.GetStore().SetFormula(C.GoString(key), C.GoString(expr)))
+}
+
+//export Store_GetFormula
+func Store_GetFormula(key *C.char) *C.char {
+	return C.CString(store.GetStore().GetFormula(C.GoString(key))) // caller must free
+}
+
+// ---- Expiry ----
+
+//export Store_SetBoolWithTTL
+func Store_SetBoolWithTTL(key *C.char, val C.bool, ttl C.double) C.bool {
+	return storeResult(store.GetStore().SetWithTTL(C.GoString(key), bool(val), float64(ttl)))
+}
+
+//export Store_SetIntWithTTL
+func Store_SetIntWithTTL(key *C.char, val C.longlong, ttl C.double) C.bool {
+	return storeResult(store.GetStore().SetWithTTL(C.GoString(key), int64(val), float64(ttl)))
+}
+
+//export Store_SetFloatWithTTL
+func Store_SetFloatWithTTL(key *C.char, val C.double, ttl C.double) C.bool {
+	return storeResult(store.GetStore().SetWithTTL(C.GoString(key), float64(val), float64(ttl)))
+}
+
+//export Store_SetTTL
+func Store_SetTTL(key *C.char, ttl C.double) C.bool {
+	return storeResult(store.GetStore().SetTTL(C.GoString(key), float64(ttl)))
+}
+
+//export Store_Persist
+func Store_Persist(key *C.char) C.bool {
+	return storeFound(store.GetStore().Persist(C.GoString(key)))
+}
+
+// Store_GetTTL returns the game time left before a key expires, or -1 if it
+// has no TTL
+//export Store_GetTTL
+func Store_GetTTL(key *C.char) C.double {
+	left, ok := store.GetStore().TTL(C.GoString(key))
+	if !ok {
+		return -1
+	}
+	return C.double(left)
+}
+
+// Store_Advance moves the game clock and returns how many keys expired
+//export Store_Advance
+func Store_Advance(dt C.double) C.int {
+	return C.int(len(store.GetStore().Advance(float64(dt))))
+}
+
+//export Store_SetPaused
+func Store_SetPaused(paused C.bool) {
+	store.GetStore().SetPaused(bool(paused))
+}
+
+//export Store_IsPaused
+func Store_IsPaused() C.bool {
+	return C.bool(store.GetStore().Paused())
+}
+
+// ---- Checkpoints ----
+
+// Store_Checkpoint copies the keys under prefix, or the whole store for an
+// empty prefix, into a named checkpoint; persisted ones are written by Save
+//export Store_Checkpoint
+func Store_Checkpoint(name *C.char, prefix *C.char, persist C.bool) {
+	store.GetStore().Checkpoint(C.GoString(name), C.GoString(prefix), bool(persist))
+}
+
+//export Store_RestoreCheckpoint
+func Store_RestoreCheckpoint(name *C.char) C.bool {
+	return C.bool(store.GetStore().RestoreCheckpoint(C.GoString(name)))
+}
+
+//export Store_DeleteCheckpoint
+func Store_DeleteCheckpoint(name *C.char) C.bool {
+	return C.bool(store.GetStore().DeleteCheckpoint(C.GoString(name)))
+}
+
+// Store_OpenCheckpointIter returns a handle over the checkpoint names, read
+// with Store_IterNext and released with Store_CloseIter
+//export Store_OpenCheckpointIter
+func Store_OpenCheckpointIter() C.int {
+	return C.int(store.OpenIter(store.GetStore().Checkpoints()))
+}
+
+// ---- Queries ----
+// Query handles are read with Store_IterNext and released with Store_CloseIter.
+// Patterns match one key segment per "*" and any number per "**".
+
+//export Store_OpenMatchIter
+func Store_OpenMatchIter(pattern *C.char) C.int {
+	return C.int(store.OpenIter(store.GetStore().Match(C.GoString(pattern))))
+}
+
+// Store_OpenTypeIter iterates the keys matching pattern whose value has the
+// given store.ValueType
+//export Store_OpenTypeIter
+func Store_OpenTypeIter(pattern *C.char, valueType C.int) C.int {
+	keys := store.GetStore().Find(store.Query{
+		Pattern: C.GoString(pattern),
+		Types:   []store.ValueType{store.ValueType(valueType)},
+	})
+	return C.int(store.OpenIter(keys))
+}
+
+// Store_OpenRangeIter iterates the keys matching pattern whose numeric value
+// lies in [min, max)
+//export Store_OpenRangeIter
+func Store_OpenRangeIter(pattern *C.char, min C.double, max C.double) C.int {
+	lo, hi := float64(min), float64(max)
+	keys := store.GetStore().Find(store.Query{Pattern: C.GoString(pattern), Min: &lo, Max: &hi})
+	return C.int(store.OpenIter(keys))
+}
+
+// Store_OpenKeysIter iterates every key under prefix at any depth
+//export Store_OpenKeysIter
+func Store_OpenKeysIter(prefix *C.char) C.int {
+	return C.int(store.OpenIter(store.GetStore().AllKeys(C.GoString(prefix))))
+}
+
+// ---- Lists ----
+
+//export Store_AppendString
+func Store_AppendString(key *C.char, val *C.char) C.bool {
+	return storeResult(store.GetStore().AppendString(C.GoString(key), C.GoString(val)))
+}
+
+//export Store_RemoveString
+func Store_RemoveString(key *C.char, val *C.char) C.bool {
+	return storeFound(store.GetStore().RemoveString(C.GoString(key), C.GoString(val)))
+}
+
+//export Store_ContainsString
+func Store_ContainsString(key *C.char, val *C.char) C.bool {
+	return C.bool(store.GetStore().ContainsString(C.GoString(key), C.GoString(val)))
+}
+
+//export Store_AppendInt
+func Store_AppendInt(key *C.char, val C.longlong) C.bool {
+	return storeResult(store.GetStore().AppendInt(C.GoString(key), int64(val)))
+}
+
+//export Store_RemoveInt
+func Store_RemoveInt(key *C.char, val C.longlong) C.bool {
+	return storeFound(store.GetStore().RemoveInt(C.GoString(key), int64(val)))
+}
+
+//export Store_ContainsInt
+func Store_ContainsInt(key *C.char, val C.longlong) C.bool {
+	return C.bool(store.GetStore().ContainsInt(C.GoString(key), int64(val)))
+}
+
+//export Store_ListLen
+func Store_ListLen(key *C.char) C.int {
+	return C.int(store.GetStore().ListLen(C.GoString(key)))
+}
+
+//export Store_OpenStringListIter
+func Store_OpenStringListIter(key *C.char) C.int {
+	return C.int(store.OpenIter(store.GetStore().GetStringList(C.GoString(key))))
+}
+
+//export Store_IterNext
+func Store_IterNext(handle C.int) *C.char {
+	return C.CString(store.IterNext(int(handle))) // caller must free
+}
+
+//export Store_CloseIter
+func Store_CloseIter(handle C.int) {
+	store.CloseIter(int(handle))
+}
+
+// Store_OpenIntListIter iterates an int list; use Store_ListLen for the
+// count since Store_IntIterNext returns 0 once exhausted
+//export Store_OpenIntListIter
+func Store_OpenIntListIter(key *C.char) C.int {
+	return C.int(store.OpenIntIter(store.GetStore().GetIntList(C.GoString(key))))
+}
+
+//export Store_IntIterNext
+func Store_IntIterNext(handle C.int) C.longlong {
+	val, _ := store.IntIterNext(int(handle))
+	return C.longlong(val)
+}
+
+//export Store_CloseIntIter
+func Store_CloseIntIter(handle C.int) {
+	store.CloseIntIter(int(handle))
+}
+
+// ---- Change queue ----
+
+// Store_Subscribe queues changes to keys under prefix and returns the
+// subscription ID
+//export Store_Subscribe
+func Store_Subscribe(prefix *C.char) C.int {
+	return C.int(store.GetStore().Subscribe(C.GoString(prefix)))
+}
+
+// Store_PollChange returns the key of the oldest queued change, or "" when
+// the queue is empty. Read the new value with the typed getters and the old
+// one with Store_PolledOldType and Store_PolledOldValue.
+//export Store_PollChange
+func Store_PollChange(subID C.int) *C.char {
+	c, ok := store.GetStore().PollChange(int(subID))
+	polledMu.Lock()
+	defer polledMu.Unlock()
+	if !ok {
+		delete(polled, int(subID))
+		return C.CString("")
+	}
+	polled[int(subID)] = c
+	return C.CString(c.Key) // caller must free
+}
+
+// The change last returned by Store_PollChange for each subscription
+var (
+	polledMu sync.Mutex
+	polled   = make(map[int]store.Change)
+)
+
+// Store_PolledOldType returns the value type the key of the last polled
+// change had before it, or -1 if the change created the key
+//export Store_PolledOldType
+func Store_PolledOldType(subID C.int) C.int {
+	polledMu.Lock()
+	defer polledMu.Unlock()
+	c, ok := polled[int(subID)]
+	if !ok || c.Old == nil {
+		return -1
+	}
+	return C.int(c.Old.Type)
+}
+
+// Store_PolledOldValue returns the value the key of the last polled change
+// had before it as text, or "" if the change created the key. Lists are
+// written like [a b c].
+//export Store_PolledOldValue
+func Store_PolledOldValue(subID C.int) *C.char {
+	polledMu.Lock()
+	defer polledMu.Unlock()
+	c, ok := polled[int(subID)]
+	if !ok || c.Old == nil {
+		return C.CString("")
+	}
+	return C.CString(fmt.Sprint(c.Old.Value)) // caller must free
+}
+
+//export Store_Unsubscribe
+func Store_Unsubscribe(subID C.int) C.bool {
+	polledMu.Lock()
+	delete(polled, int(subID))
+	polledMu.Unlock()
+	return C.bool(store.GetStore().Unwatch(int(subID)))
+}
+
 // ---- Persistence ----
 
 //export Storage_Save
@@ -688,6 +1426,142 @@ func Crafting_Next() *C.char {
 	return C.CString(crafting.Next())
 }
 
+//export Crafting_InitIterateRecipes
+func Crafting_InitIterateRecipes(managerName *C.char, output *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(0)
+	}
+	return C.int(m.IterateRecipes(C.GoString(output)))
+}
+
+//export Crafting_CraftFromInventory
+func Crafting_CraftFromInventory(managerName *C.char, output *C.char, invID C.int) *C.char {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.CString("")
+	}
+	inv := inventory.GetInventory(int(invID))
+	if inv == nil {
+		return C.CString("")
+	}
+	c, ok := m.Craft(C.GoString(output), crafting.InventoryStock{Inv: inv})
+	if !ok {
+		return C.CString("")
+	}
+	return C.CString(c.ID)
+}
+
+//export Crafting_GetStation
+func Crafting_GetStation(managerName *C.char, craftID *C.char) *C.char {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.CString("")
+	}
+	c, exists := m.GetCraftable(C.GoString(craftID))
+	if !exists {
+		return C.CString("")
+	}
+	return C.CString(c.Station)
+}
+
+//export Crafting_GetUnlockState
+func Crafting_GetUnlockState(managerName *C.char, profile *C.char, craftID *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(crafting.Locked)
+	}
+	return C.int(m.UnlockState(C.GoString(profile), C.GoString(craftID)))
+}
+
+//export Crafting_DiscoverRecipe
+func Crafting_DiscoverRecipe(managerName *C.char, profile *C.char, craftID *C.char) C.bool {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return false
+	}
+	return C.bool(m.Discover(C.GoString(profile), C.GoString(craftID)))
+}
+
+//export Crafting_LearnRecipe
+func Crafting_LearnRecipe(managerName *C.char, profile *C.char, craftID *C.char) C.bool {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return false
+	}
+	return C.bool(m.Learn(C.GoString(profile), C.GoString(craftID)))
+}
+
+//export Crafting_InitIterateAvailable
+func Crafting_InitIterateAvailable(managerName *C.char, profile *C.char, station *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(0)
+	}
+	return C.int(m.IterateAvailable(C.GoString(profile), C.GoString(station)))
+}
+
+//export Crafting_OpenCraftablesIter
+func Crafting_OpenCraftablesIter(managerName *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(0)
+	}
+	return C.int(crafting.OpenIter(m.CraftableIDs()))
+}
+
+//export Crafting_OpenRecipesIter
+func Crafting_OpenRecipesIter(managerName *C.char, output *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(0)
+	}
+	return C.int(crafting.OpenIter(m.RecipeIDs(C.GoString(output))))
+}
+
+//export Crafting_OpenAvailableIter
+func Crafting_OpenAvailableIter(managerName *C.char, profile *C.char, station *C.char) C.int {
+	m, ok := crafting.Get(C.GoString(managerName))
+	if !ok {
+		return C.int(0)
+	}
+	return C.int(crafting.OpenIter(m.AvailableIDs(C.GoString(profile), C.GoString(station))))
+}
+
+//export Crafting_IterLen
+func Crafting_IterLen(handle C.int) C.int {
+	return C.int(crafting.IterLen(int(handle)))
+}
+
+//export Crafting_IterNext
+func Crafting_IterNext(handle C.int) *C.char {
+	return C.CString(crafting.IterNext(int(handle)))
+}
+
+//export Crafting_CloseIter
+func Crafting_CloseIter(handle C.int) {
+	crafting.CloseIter(int(handle))
+}
+
+//export Crafting_SetStrictValidation
+func Crafting_SetStrictValidation(enabled C.bool) {
+	crafting.SetStrict(bool(enabled))
+}
+
+//export Crafting_AddKnownItem
+func Crafting_AddKnownItem(itemID *C.char) {
+	crafting.AddKnownItems(C.GoString(itemID))
+}
+
+//export Crafting_GetValidationErrors
+func Crafting_GetValidationErrors() *C.char {
+	errs := crafting.LastValidationErrors()
+	if len(errs) == 0 {
+		return C.CString("")
+	}
+	return C.CString(errs.Error())
+}
+
 
 //export Helpers_GetUpgradeSelections
 func Helpers_GetUpgradeSelections(count C.int) C.bool {
@@ -707,6 +1581,181 @@ func Helpers_Next() *C.char {
 	return C.CString(item)
 }
 
+//export Helpers_StartRun
+func Helpers_StartRun(seed C.longlong, rerolls C.int, banishes C.int) {
+	helpers.StartRun(int64(seed), int(rerolls), int(banishes))
+}
+
+// Helpers_Reroll replaces the current offer; Helpers_Next walks the new one
+//export Helpers_Reroll
+func Helpers_Reroll() C.bool {
+	return C.bool(helpers.RerollSelections())
+}
+
+// Helpers_Banish removes an upgrade for the rest of the run; Helpers_Next
+// walks what is left of the current offer
+//export Helpers_Banish
+func Helpers_Banish(itemID *C.char) C.bool {
+	return C.bool(helpers.BanishSelection(C.GoString(itemID)))
+}
+
+//export Helpers_IsBanished
+func Helpers_IsBanished(itemID *C.char) C.bool {
+	return C.bool(helpers.IsBanished(C.GoString(itemID)))
+}
+
+//export Helpers_RerollsLeft
+func Helpers_RerollsLeft() C.int {
+	return C.int(helpers.RerollsLeft())
+}
+
+//export Helpers_BanishesLeft
+func Helpers_BanishesLeft() C.int {
+	return C.int(helpers.BanishesLeft())
+}
+
+// Helpers_System* functions address an upgrade system by ID. Each system
+// offers the recipes of its own crafting manager against its own equipment
+// manager; ID 0 is the default system behind the functions above.
+
+// Helpers_NewSystem creates an upgrade system. slotTypeKey is the store key
+// slot types are read from with {id} standing for the item ID; empty uses
+// "{id}.slot_type".
+//export Helpers_NewSystem
+func Helpers_NewSystem(craftingName *C.char, equipmentID C.int, slotTypeKey *C.char) C.int {
+	key := C.GoString(slotTypeKey)
+	if key == "" {
+		key = helpers.DefaultSlotTypeKey
+	}
+	sys := helpers.NewUpgradeSystem(C.GoString(craftingName), int(equipmentID), helpers.StoreSlotTypes(key))
+	return C.int(helpers.RegisterSystem(sys))
+}
+
+//export Helpers_FreeSystem
+func Helpers_FreeSystem(systemID C.int) C.bool {
+	return C.bool(helpers.RemoveSystem(int(systemID)))
+}
+
+//export Helpers_SystemStartRun
+func Helpers_SystemStartRun(systemID C.int, seed C.longlong, rerolls C.int, banishes C.int) C.bool {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return false
+	}
+	sys.StartRun(int64(seed), int(rerolls), int(banishes))
+	return true
+}
+
+// Helpers_SystemOffer rolls a new offer and returns an iterator handle over
+// it, or 0 if the system doesn't exist
+//export Helpers_SystemOffer
+func Helpers_SystemOffer(systemID C.int, count C.int) C.int {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return 0
+	}
+	sys.Offer(int(count))
+	return C.int(helpers.OpenOfferIter(int(systemID)))
+}
+
+// Helpers_SystemReroll returns an iterator handle over the new offer, or 0
+// if the system doesn't exist or has no rerolls left
+//export Helpers_SystemReroll
+func Helpers_SystemReroll(systemID C.int) C.int {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return 0
+	}
+	if _, ok := sys.Reroll(); !ok {
+		return 0
+	}
+	return C.int(helpers.OpenOfferIter(int(systemID)))
+}
+
+//export Helpers_SystemBanish
+func Helpers_SystemBanish(systemID C.int, itemID *C.char) C.bool {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return false
+	}
+	return C.bool(sys.Banish(C.GoString(itemID)))
+}
+
+//export Helpers_SystemPick
+func Helpers_SystemPick(systemID C.int, itemID *C.char) C.bool {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return false
+	}
+	return C.bool(sys.Pick(C.GoString(itemID)))
+}
+
+// Helpers_SystemUpgradeKind returns 1 for a new item, 2 for an evolution and
+// 3 for a level up, or 0 if the upgrade is unknown
+//export Helpers_SystemUpgradeKind
+func Helpers_SystemUpgradeKind(systemID C.int, itemID *C.char) C.int {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return C.int(helpers.UpgradeUnknown)
+	}
+	return C.int(sys.Kind(C.GoString(itemID)))
+}
+
+//export Helpers_GetItemLevel
+func Helpers_GetItemLevel(itemID *C.char) C.int {
+	return C.int(helpers.ItemLevel(C.GoString(itemID)))
+}
+
+// Helpers_SystemGetItemLevel returns the level of an item in a system's run,
+// or 0 if the system doesn't exist
+//export Helpers_SystemGetItemLevel
+func Helpers_SystemGetItemLevel(systemID C.int, itemID *C.char) C.int {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return 0
+	}
+	return C.int(sys.ItemLevel(C.GoString(itemID)))
+}
+
+//export Helpers_GetMaxLevel
+func Helpers_GetMaxLevel(itemID *C.char) C.int {
+	return C.int(helpers.MaxLevel(C.GoString(itemID)))
+}
+
+// Helpers_SystemExportHistory returns the run history as a JSON list
+//export Helpers_SystemExportHistory
+func Helpers_SystemExportHistory(systemID C.int) *C.char {
+	sys := helpers.GetSystem(int(systemID))
+	if sys == nil {
+		return C.CString("[]")
+	}
+	out, err := sys.ExportHistory()
+	if err != nil {
+		return C.CString("[]")
+	}
+	return C.CString(out)
+}
+
+//export Helpers_OpenOfferIter
+func Helpers_OpenOfferIter(systemID C.int) C.int {
+	return C.int(helpers.OpenOfferIter(int(systemID)))
+}
+
+//export Helpers_OpenUpgradesIter
+func Helpers_OpenUpgradesIter(systemID C.int) C.int {
+	return C.int(helpers.OpenUpgradesIter(int(systemID)))
+}
+
+//export Helpers_IterNext
+func Helpers_IterNext(handle C.int) *C.char {
+	return C.CString(helpers.IterNext(int(handle)))
+}
+
+//export Helpers_CloseIter
+func Helpers_CloseIter(handle C.int) {
+	helpers.CloseIter(int(handle))
+}
+
 //export Store_InitGetFullKeysIter
 func Store_InitGetFullKeysIter(prefix *C.char) C.int {
 	p := C.GoString(prefix)
@@ -5,70 +5,115 @@ import (
 	"codex/pkg/storage"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 )
 
 // --------- Core Types ----------
 
+// Requirement is an item a recipe needs. Upgrade evolutions also use Level,
+// the minimum upgrade level of the required item, and Keep, which leaves the
+// item in place instead of consuming it.
 type Requirement struct {
-	ID  string `json:"id"`
-	Qty int    `json:"qty"`
+	ID    string `json:"id"`
+	Qty   int    `json:"qty"`
+	Level int    `json:"level,omitempty"`
+	Keep  bool   `json:"keep,omitempty"`
 }
 
+// Craftable is a single recipe. Several recipes may share an Output; an
+// empty Output means the recipe produces the item named by its ID. Higher
+// Priority recipes are preferred when more than one can be used. Station
+// names the workbench type needed, empty meaning it can be crafted anywhere.
 type Craftable struct {
-	ID           string        `json:"id"`
-	Requirements []Requirement `json:"requirements"`
+	ID           string           `json:"id"`
+	Output       string           `json:"output,omitempty"`
+	Priority     int              `json:"priority,omitempty"`
+	Station      string           `json:"station,omitempty"`
+	Unlock       *UnlockCondition `json:"unlock,omitempty"`
+	Requirements []Requirement    `json:"requirements"`
 }
 
 // --------- Manager ----------
 
 type Manager struct {
+	mu           sync.RWMutex
+	name         string
 	craftables   map[string]Craftable
 	requireIndex map[string][]string
+	outputIndex  map[string][]string
 }
 
-var craftIter *iterator.Iterator[string]
+// craftIter is the shared iterator behind Next; craftIterMu guards it
+var (
+	craftIter   *iterator.Iterator[string]
+	craftIterMu sync.Mutex
+)
 
 func init() {
     // Register load and save functions
     storage.SM().BindFuncs("crafting", LoadManagers, nil)
+    storage.SM().BindFuncs("crafting_unlocks", LoadUnlocks, SaveUnlocks)
 }
 
+// LoadManagers validates and registers every manager in data. All problems
+// are returned as ValidationErrors; in strict mode managers with problems are
+// not registered. An UncheckedItems notice alone is not returned, only kept
+// for LastValidationErrors. Revalidate checks the managers again once item
+// definitions load.
 func LoadManagers(data json.RawMessage) error {
     var loadedManagers  map[string][]Craftable
     if err := json.Unmarshal(data, &loadedManagers); err != nil {
         return fmt.Errorf("failed to unmarshal crafting: %w", err)
     }
-    
-    for k, v := range loadedManagers {
-        m := NewManager()
-		for _, c := range v {
-			m.craftables[c.ID] = c
-			for _, req := range c.Requirements {
-				m.requireIndex[req.ID] = append(m.requireIndex[req.ID], c.ID)
-			}
-		}
-		Register(k, m)
-    }
-    
-    return nil
+    return registerManagers(loadedManagers, false)
 }
 
 func NewManager() *Manager {
 	return &Manager{
 		craftables:   make(map[string]Craftable),
 		requireIndex: make(map[string][]string),
+		outputIndex:  make(map[string][]string),
+	}
+}
+
+// add stores c unless its ID is already taken, indexing each requirement once
+func (m *Manager) add(c Craftable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.craftables[c.ID]; exists {
+		return
+	}
+	if c.Output == "" {
+		c.Output = c.ID
+	}
+	m.craftables[c.ID] = c
+	m.outputIndex[c.Output] = append(m.outputIndex[c.Output], c.ID)
+	sortRecipes(m.outputIndex[c.Output], m.craftables)
+
+	seen := make(map[string]struct{}, len(c.Requirements))
+	for _, req := range c.Requirements {
+		if _, dup := seen[req.ID]; dup {
+			continue
+		}
+		seen[req.ID] = struct{}{}
+		m.requireIndex[req.ID] = append(m.requireIndex[req.ID], c.ID)
 	}
 }
 
 // Forward lookup
 func (m *Manager) GetCraftable(id string) (Craftable, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	c, ok := m.craftables[id]
 	return c, ok
 }
 
 // Reverse lookup
 func (m *Manager) FindByRequirement(reqID string) []Craftable {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	var results []Craftable
 	for _, cid := range m.requireIndex[reqID] {
 		if c, ok := m.craftables[cid]; ok {
@@ -78,17 +123,72 @@ func (m *Manager) FindByRequirement(reqID string) []Craftable {
 	return results
 }
 
-// IterateCraftables returns an iterator over craftable IDs.
-func (m *Manager) IterateCraftables() int{
+// RecipesFor returns every recipe producing output, highest priority first
+func (m *Manager) RecipesFor(output string) []Craftable {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := make([]Craftable, 0, len(m.outputIndex[output]))
+	for _, cid := range m.outputIndex[output] {
+		results = append(results, m.craftables[cid])
+	}
+	return results
+}
+
+// sortRecipes orders recipe IDs by descending priority, then by ID
+func sortRecipes(ids []string, craftables map[string]Craftable) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := craftables[ids[i]], craftables[ids[j]]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.ID < b.ID
+	})
+}
+
+// CraftableIDs returns every craftable ID in sorted order
+func (m *Manager) CraftableIDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	ids := make([]string, 0, len(m.craftables))
 	for id := range m.craftables {
 		ids = append(ids, id)
 	}
-	craftIter = iterator.NewIterator(ids)
+	sort.Strings(ids)
+	return ids
+}
+
+// RecipeIDs returns the recipe IDs for output, highest priority first
+func (m *Manager) RecipeIDs(output string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.outputIndex[output]...)
+}
+
+// IterateRecipes points the shared iterator at the recipe IDs for output
+func (m *Manager) IterateRecipes(output string) int {
+	ids := m.RecipeIDs(output)
+	setCraftIter(ids)
 	return len(ids)
 }
 
+// IterateCraftables points the shared iterator at the sorted craftable IDs.
+// Prefer OpenIter when more than one caller may iterate at the same time.
+func (m *Manager) IterateCraftables() int{
+	ids := m.CraftableIDs()
+	setCraftIter(ids)
+	return len(ids)
+}
+
+// setCraftIter points the shared iterator at ids
+func setCraftIter(ids []string) {
+	craftIterMu.Lock()
+	defer craftIterMu.Unlock()
+	craftIter = iterator.NewIterator(ids)
+}
+
 func Next() string{
+	craftIterMu.Lock()
+	defer craftIterMu.Unlock()
 	if craftIter == nil {
 		return ""
 	}
@@ -96,6 +196,31 @@ func Next() string{
 	return val
 }
 
+// --------- Iterator Handles ----------
+
+var iters = iterator.NewHandles[string]()
+
+// OpenIter starts an independent iteration over ids and returns its handle
+func OpenIter(ids []string) int {
+	return iters.Open(ids)
+}
+
+// IterNext returns the next ID of handle, or "" once it is exhausted
+func IterNext(handle int) string {
+	val, _ := iters.Next(handle)
+	return val
+}
+
+// IterLen returns the number of IDs behind handle
+func IterLen(handle int) int {
+	return iters.Len(handle)
+}
+
+// CloseIter releases handle
+func CloseIter(handle int) {
+	iters.Close(handle)
+}
+
 // --------- Global Registry ----------
 
 var (
@@ -103,10 +228,17 @@ var (
 	mu       sync.RWMutex
 )
 
-// Register new manager under a namespace
+// Register new manager under a namespace. A nil manager is not registered
+// and 0 is returned.
 func Register(name string, manager *Manager) int {
+	if manager == nil {
+		return 0
+	}
 	mu.Lock()
 	defer mu.Unlock()
+	manager.mu.Lock()
+	manager.name = name
+	manager.mu.Unlock()
 	registry[name] = manager
 	return 1
 }
@@ -124,6 +256,7 @@ func Reset(name string) {
 	mu.Lock()
 	defer mu.Unlock()
 	delete(registry, name)
+	forgetLoadedLocked(name)
 }
 
 // Reset all managers
@@ -131,4 +264,5 @@ func ResetAll() {
 	mu.Lock()
 	defer mu.Unlock()
 	registry = make(map[string]*Manager)
+	loaded, refused = nil, nil
 }
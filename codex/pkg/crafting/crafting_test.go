@@ -2,7 +2,12 @@ package crafting
 
 import (
 	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
+	"codex/pkg/inventory"
+	"codex/pkg/metrics"
+	"codex/pkg/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -80,6 +85,11 @@ func TestRegistry_ResetSingleAndAll(t *testing.T) {
 	ResetAll()
 	_, ok = Get("m2")
 	assert.False(t, ok)
+
+	// A nil manager is ignored
+	assert.Equal(t, 0, Register("m3", nil))
+	_, ok = Get("m3")
+	assert.False(t, ok)
 }
 
 func TestIterateCraftables(t *testing.T) {
@@ -100,8 +110,8 @@ func TestIterateCraftables(t *testing.T) {
 		collected = append(collected, id)
 	}
 
-	// We know "test" manager has these IDs
-	assert.ElementsMatch(t, []string{"axe", "pickaxe", "potion"}, collected)
+	// We know "test" manager has these IDs, iterated in sorted order
+	assert.Equal(t, []string{"axe", "pickaxe", "potion"}, collected)
 }
 
 func TestIterateCraftables_EmptyManager(t *testing.T) {
@@ -119,3 +129,336 @@ func TestIterateCraftables_EmptyManager(t *testing.T) {
 
 	assert.Empty(t, collected)
 }
+
+func TestLoadManagers_ValidationErrors(t *testing.T) {
+	ResetAll()
+	defer ResetKnownItems()
+	AddKnownItems("wood", "iron")
+
+	data := `{
+		"bad": [
+			{"id":"axe","requirements":[{"id":"wood","qty":3},{"id":"wood","qty":1}]},
+			{"id":"axe","requirements":[{"id":"iron","qty":1}]},
+			{"id":"sword","requirements":[{"id":"iron","qty":0},{"id":"mithril","qty":1}]},
+			{"id":"egg","requirements":[{"id":"chicken","qty":1}]},
+			{"id":"chicken","requirements":[{"id":"egg","qty":1}]},
+			{"id":"base","requirements":[{"id":"","qty":0}]}
+		]
+	}`
+	err := LoadManagers(json.RawMessage(data))
+	assert.Error(t, err)
+
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+
+	kinds := map[ErrorKind][]string{}
+	for _, e := range errs {
+		assert.Equal(t, "bad", e.Manager)
+		kinds[e.Kind] = append(kinds[e.Kind], e.CraftID)
+	}
+	assert.Equal(t, []string{"axe"}, kinds[DuplicateID])
+	assert.Equal(t, []string{"axe"}, kinds[DuplicateRequirement])
+	assert.Equal(t, []string{"sword"}, kinds[InvalidQuantity])
+	assert.Equal(t, []string{"sword"}, kinds[UnknownItem])
+	assert.Equal(t, []string{"chicken"}, kinds[Cycle])
+	assert.Equal(t, errs, LastValidationErrors())
+
+	// Lenient mode still registers, keeping the first definition
+	m, ok := Get("bad")
+	assert.True(t, ok)
+	axe, _ := m.GetCraftable("axe")
+	assert.Equal(t, "wood", axe.Requirements[0].ID)
+	assert.Len(t, m.FindByRequirement("wood"), 1)
+}
+
+func TestLoadManagers_StrictRefusesBadManager(t *testing.T) {
+	ResetAll()
+	SetStrict(true)
+	defer SetStrict(false)
+
+	data := `{
+		"good": [{"id":"potion","requirements":[{"id":"herb","qty":2}]}],
+		"bad": [{"id":"potion","requirements":[{"id":"herb","qty":-1}]}]
+	}`
+	err := LoadManagers(json.RawMessage(data))
+	assert.Error(t, err)
+
+	_, ok := Get("good")
+	assert.True(t, ok)
+	_, ok = Get("bad")
+	assert.False(t, ok)
+
+	assert.NoError(t, LoadManagers(json.RawMessage(`{"good": []}`)))
+	assert.Empty(t, LastValidationErrors())
+}
+
+func TestValidate_ItemSourceAndUncheckedItems(t *testing.T) {
+	recipes := []Craftable{
+		{ID: "potion", Requirements: []Requirement{{ID: "herb", Qty: 1}, {ID: "hreb", Qty: 1}}},
+	}
+
+	// Nothing known: the references are counted, not silently accepted
+	errs := Validate("potions", recipes)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, UncheckedItems, errs[0].Kind)
+	assert.Contains(t, errs[0].Detail, "2 references")
+	assert.False(t, errs.refuses())
+
+	// Loaded item definitions are known without AddKnownItems
+	SetItemSource(func() []string { return []string{"herb"} })
+	defer SetItemSource(nil)
+	errs = Validate("potions", recipes)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, UnknownItem, errs[0].Kind)
+	assert.Contains(t, errs[0].Detail, `"hreb"`)
+	assert.True(t, errs.refuses())
+	SetItemSource(nil)
+
+	// A notice alone doesn't fail the load but is kept for inspection
+	ResetAll()
+	assert.NoError(t, LoadManagers(json.RawMessage(`{"potions": [{"id":"potion","requirements":[{"id":"herb","qty":1}]}]}`)))
+	assert.Equal(t, UncheckedItems, LastValidationErrors()[0].Kind)
+	_, ok := Get("potions")
+	assert.True(t, ok)
+}
+
+func TestRevalidate_ItemsLoadedAfterRecipes(t *testing.T) {
+	ResetAll()
+	defer ResetAll()
+	defer ResetKnownItems()
+	SetStrict(true)
+	defer SetStrict(false)
+	AddKnownItems("wood")
+
+	// The recipes load before the items they use are defined
+	data := `{
+		"forge": [{"id":"sword","requirements":[{"id":"wood","qty":1},{"id":"iron","qty":2}]}],
+		"camp": [{"id":"torch","requirements":[{"id":"wood","qty":1}]}]
+	}`
+	assert.Error(t, LoadManagers(json.RawMessage(data)))
+	_, ok := Get("forge")
+	assert.False(t, ok)
+	camp, _ := Get("camp")
+
+	items := []string{"iron"}
+	SetItemSource(func() []string { return items })
+	defer SetItemSource(nil)
+	assert.NoError(t, Revalidate())
+	_, ok = Get("forge")
+	assert.True(t, ok)
+	assert.Empty(t, LastValidationErrors())
+	same, _ := Get("camp")
+	assert.Same(t, camp, same, "managers that passed both times are kept")
+
+	// Items that go away refuse the recipes needing them again
+	items = nil
+	assert.Error(t, Revalidate())
+	_, ok = Get("forge")
+	assert.False(t, ok)
+
+	// Reset managers stay reset
+	items = []string{"iron"}
+	Reset("forge")
+	assert.NoError(t, Revalidate())
+	_, ok = Get("forge")
+	assert.False(t, ok)
+}
+
+func TestRecipesFor_OrderedByPriority(t *testing.T) {
+	ResetAll()
+	data := `{
+		"alt": [
+			{"id":"plank.saw","output":"plank","priority":1,"requirements":[{"id":"log","qty":1}]},
+			{"id":"plank.axe","output":"plank","priority":5,"requirements":[{"id":"log","qty":2}]},
+			{"id":"plank.scrap","output":"plank","requirements":[{"id":"scrap","qty":4}]},
+			{"id":"log","requirements":[{"id":"","qty":0}]}
+		]
+	}`
+	assert.NoError(t, LoadManagers(json.RawMessage(data)))
+	m, _ := Get("alt")
+
+	var ids []string
+	for _, c := range m.RecipesFor("plank") {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []string{"plank.axe", "plank.saw", "plank.scrap"}, ids)
+
+	// Recipes without an output produce their own ID
+	logs := m.RecipesFor("log")
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "log", logs[0].Output)
+	assert.Empty(t, m.RecipesFor("nonexistent"))
+
+	assert.Equal(t, 3, m.IterateRecipes("plank"))
+	assert.Equal(t, "plank.axe", Next())
+}
+
+func TestCraft_PicksFirstAffordableRecipe(t *testing.T) {
+	ResetAll()
+	data := `{
+		"alt": [
+			{"id":"plank.big","output":"3","priority":2,"requirements":[{"id":"1","qty":5}]},
+			{"id":"plank.small","output":"3","priority":1,"requirements":[{"id":"1","qty":2}]},
+			{"id":"plank.scrap","output":"3","requirements":[{"id":"2","qty":1}]}
+		]
+	}`
+	assert.NoError(t, LoadManagers(json.RawMessage(data)))
+	m, _ := Get("alt")
+
+	inv := inventory.NewInventory(4)
+	inv.AddItem(1, true, 10, 3)
+	stock := InventoryStock{Inv: inv}
+
+	c, ok := m.Craft("3", stock)
+	assert.True(t, ok)
+	assert.Equal(t, "plank.small", c.ID)
+	assert.Equal(t, 1, inv.CountItem(1))
+
+	_, ok = m.Craft("3", stock)
+	assert.False(t, ok)
+	assert.Equal(t, 1, inv.CountItem(1))
+
+	inv.AddItem(2, true, 10, 1)
+	c, ok = m.Craft("3", stock)
+	assert.True(t, ok)
+	assert.Equal(t, "plank.scrap", c.ID)
+	assert.Equal(t, 0, inv.CountItem(2))
+}
+
+func TestCraft_SumsDuplicateRequirements(t *testing.T) {
+	ResetAll()
+	data := `{"dup": [{"id":"ingot","output":"3","requirements":[{"id":"1","qty":2},{"id":"1","qty":2}]}]}`
+	LoadManagers(json.RawMessage(data))
+	m, _ := Get("dup")
+
+	inv := inventory.NewInventory(4)
+	inv.AddItem(1, true, 10, 3)
+	stock := InventoryStock{Inv: inv}
+
+	c, _ := m.GetCraftable("ingot")
+	assert.False(t, CanAfford(c, stock))
+	_, ok := m.Craft("3", stock)
+	assert.False(t, ok)
+	assert.Equal(t, 3, inv.CountItem(1), "nothing is consumed when short")
+
+	inv.AddItem(1, true, 10, 1)
+	_, ok = m.Craft("3", stock)
+	assert.True(t, ok)
+	assert.Equal(t, 0, inv.CountItem(1))
+}
+
+func TestUnlockStateAndStations(t *testing.T) {
+	ResetAll()
+	ResetUnlocks()
+	metrics.Default = metrics.NewRegistry()
+	store.GetStore().Clear("test_unlock")
+
+	data := `{
+		"bench": [
+			{"id":"bandage","requirements":[{"id":"cloth","qty":1}]},
+			{"id":"sword","station":"anvil","requirements":[{"id":"iron","qty":3}]},
+			{"id":"shield","station":"anvil","unlock":{"store_flag":"test_unlock.shield"},"requirements":[{"id":"iron","qty":5}]},
+			{"id":"bomb","unlock":{"metric":"kills","threshold":10},"requirements":[{"id":"powder","qty":1}]}
+		]
+	}`
+	assert.NoError(t, LoadManagers(json.RawMessage(data)))
+	m, _ := Get("bench")
+
+	assert.Equal(t, Learned, m.UnlockState("p1", "sword"))
+	assert.Equal(t, Locked, m.UnlockState("p1", "shield"))
+	assert.Equal(t, Locked, m.UnlockState("p1", "bomb"))
+	assert.False(t, m.Learn("p1", "shield"))
+
+	ids := func(cs []Craftable) []string {
+		out := []string{}
+		for _, c := range cs {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"bandage"}, ids(m.Available("p1", "")))
+	assert.Equal(t, []string{"bandage", "sword"}, ids(m.Available("p1", "anvil")))
+
+	store.GetStore().SetBool("test_unlock.shield", true)
+	metrics.AddInt("kills", 10)
+	assert.Equal(t, Discovered, m.UnlockState("p1", "shield"))
+	assert.Equal(t, Discovered, m.UnlockState("p1", "bomb"))
+	assert.True(t, m.Learn("p1", "shield"))
+	assert.Equal(t, []string{"bandage", "shield", "sword"}, ids(m.Available("p1", "anvil")))
+	assert.Equal(t, []string{"bandage", "sword"}, ids(m.Available("p2", "anvil")))
+
+	// Progress survives a save/load round trip even after the flag is gone
+	saved, err := SaveUnlocks()
+	assert.NoError(t, err)
+	ResetUnlocks()
+	store.GetStore().SetBool("test_unlock.shield", false)
+	assert.Equal(t, Locked, m.UnlockState("p1", "shield"))
+	assert.NoError(t, LoadUnlocks(saved.(json.RawMessage)))
+	assert.Equal(t, Learned, m.UnlockState("p1", "shield"))
+
+	assert.Equal(t, 3, m.IterateAvailable("p1", "anvil"))
+	assert.Equal(t, "bandage", Next())
+}
+
+func TestIterHandles_Independent(t *testing.T) {
+	loadTestData(t)
+	m, _ := Get("test")
+
+	a := OpenIter(m.CraftableIDs())
+	b := OpenIter(m.CraftableIDs())
+	defer CloseIter(a)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, 3, IterLen(a))
+
+	assert.Equal(t, "axe", IterNext(a))
+	assert.Equal(t, "pickaxe", IterNext(a))
+	assert.Equal(t, "axe", IterNext(b))
+	assert.Equal(t, "potion", IterNext(a))
+	assert.Equal(t, "", IterNext(a))
+
+	CloseIter(b)
+	assert.Equal(t, "", IterNext(b))
+	assert.Equal(t, 0, IterLen(b))
+	assert.Equal(t, "", IterNext(0))
+}
+
+func TestManager_ConcurrentAccess(t *testing.T) {
+	m := NewManager()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id := fmt.Sprintf("item.%d.%d", i, j)
+				m.add(Craftable{ID: id, Requirements: []Requirement{{ID: "wood", Qty: 1}}})
+				m.GetCraftable(id)
+				m.FindByRequirement("wood")
+				m.CraftableIDs()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, m.CraftableIDs(), 400)
+	assert.Len(t, m.FindByRequirement("wood"), 400)
+}
+
+func TestSharedIterator_ConcurrentLegacyCallers(t *testing.T) {
+	loadTestData(t)
+	m, _ := Get("test")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m.IterateCraftables()
+				m.IterateRecipes("axe")
+				m.IterateAvailable("p", "")
+				Next()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,104 @@
+package crafting
+
+import (
+	"codex/pkg/inventory"
+	"strconv"
+)
+
+// Stock is a source of items that recipe requirements are paid from
+type Stock interface {
+	Count(id string) int
+	Remove(id string, qty int) bool
+}
+
+// InventoryStock adapts an inventory to Stock. Requirement IDs are the
+// decimal form of inventory item IDs.
+type InventoryStock struct {
+	Inv *inventory.Inventory
+}
+
+func (s InventoryStock) Count(id string) int {
+	itemID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return s.Inv.CountItem(itemID)
+}
+
+func (s InventoryStock) Remove(id string, qty int) bool {
+	itemID, err := strconv.Atoi(id)
+	if err != nil {
+		return false
+	}
+	return s.Inv.RemoveItem(itemID, qty)
+}
+
+// CanAfford reports whether stock holds every requirement of c. Quantities
+// of requirements sharing an ID are added together.
+func CanAfford(c Craftable, stock Stock) bool {
+	ids, totals := requirementTotals(c.Requirements)
+	for _, id := range ids {
+		if stock.Count(id) < totals[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// Pay removes every requirement from stock, checking first that the summed
+// quantity of each ID can be paid, so nothing is removed when stock falls
+// short. Requirements with an empty ID or no quantity are free.
+func Pay(reqs []Requirement, stock Stock) bool {
+	ids, totals := requirementTotals(reqs)
+	for _, id := range ids {
+		if stock.Count(id) < totals[id] {
+			return false
+		}
+	}
+	for _, id := range ids {
+		if !stock.Remove(id, totals[id]) {
+			return false
+		}
+	}
+	return true
+}
+
+// requirementTotals sums the quantities of reqs per ID, returning the IDs in
+// the order they first appear. Free requirements are left out.
+func requirementTotals(reqs []Requirement) ([]string, map[string]int) {
+	var ids []string
+	totals := make(map[string]int, len(reqs))
+	for _, req := range reqs {
+		if req.ID == "" || req.Qty <= 0 {
+			continue
+		}
+		if _, seen := totals[req.ID]; !seen {
+			ids = append(ids, req.ID)
+		}
+		totals[req.ID] += req.Qty
+	}
+	return ids, totals
+}
+
+// FirstAffordable returns the highest priority recipe for output that stock can pay for
+func (m *Manager) FirstAffordable(output string, stock Stock) (Craftable, bool) {
+	for _, c := range m.RecipesFor(output) {
+		if CanAfford(c, stock) {
+			return c, true
+		}
+	}
+	return Craftable{}, false
+}
+
+// Craft pays for the first affordable recipe of output from stock and
+// returns the recipe used. Adding the output item is left to the caller.
+func (m *Manager) Craft(output string, stock Stock) (Craftable, bool) {
+	c, ok := m.FirstAffordable(output, stock)
+	if !ok {
+		return Craftable{}, false
+	}
+	if !Pay(c.Requirements, stock) {
+		return Craftable{}, false
+	}
+	return c, true
+}
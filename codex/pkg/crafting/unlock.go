@@ -0,0 +1,181 @@
+package crafting
+
+import (
+	"codex/pkg/metrics"
+	"codex/pkg/store"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// UnlockState is how far a profile has progressed towards using a recipe
+type UnlockState int
+
+const (
+	Locked UnlockState = iota
+	Discovered
+	Learned
+)
+
+// UnlockCondition gates a recipe behind a store flag and/or a metric
+// threshold. Every condition that is set must hold.
+type UnlockCondition struct {
+	StoreFlag string `json:"store_flag,omitempty"`
+	Metric    string `json:"metric,omitempty"`
+	Threshold int64  `json:"threshold,omitempty"`
+}
+
+// Met reports whether the condition currently holds; a nil condition always does
+func (u *UnlockCondition) Met() bool {
+	if u == nil {
+		return true
+	}
+	if u.StoreFlag != "" && !store.GetStore().GetBool(u.StoreFlag) {
+		return false
+	}
+	if u.Metric != "" && metrics.GetInt(u.Metric) < u.Threshold {
+		return false
+	}
+	return true
+}
+
+var (
+	unlockMu sync.RWMutex
+	unlocks  = make(map[string]map[string]map[string]UnlockState) // profile -> manager -> recipe
+)
+
+func storedState(profile, manager, id string) UnlockState {
+	unlockMu.RLock()
+	defer unlockMu.RUnlock()
+	return unlocks[profile][manager][id]
+}
+
+func setStoredState(profile, manager, id string, state UnlockState) {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	if unlocks[profile] == nil {
+		unlocks[profile] = make(map[string]map[string]UnlockState)
+	}
+	if unlocks[profile][manager] == nil {
+		unlocks[profile][manager] = make(map[string]UnlockState)
+	}
+	if unlocks[profile][manager][id] < state {
+		unlocks[profile][manager][id] = state
+	}
+}
+
+// UnlockState returns the state of recipe id for profile. Recipes without an
+// unlock condition are learned from the start; gated recipes are locked until
+// their condition holds and discovered afterwards until learned.
+func (m *Manager) UnlockState(profile, id string) UnlockState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.craftables[id]
+	if !ok {
+		return Locked
+	}
+	return m.unlockState(profile, c)
+}
+
+func (m *Manager) unlockState(profile string, c Craftable) UnlockState {
+	if c.Unlock == nil {
+		return Learned
+	}
+	if state := storedState(profile, m.name, c.ID); state != Locked {
+		return state
+	}
+	if c.Unlock.Met() {
+		return Discovered
+	}
+	return Locked
+}
+
+// Discover marks recipe id as discovered for profile once its condition holds
+func (m *Manager) Discover(profile, id string) bool {
+	return m.advance(profile, id, Discovered)
+}
+
+// Learn marks recipe id as learned for profile once its condition holds
+func (m *Manager) Learn(profile, id string) bool {
+	return m.advance(profile, id, Learned)
+}
+
+func (m *Manager) advance(profile, id string, state UnlockState) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.craftables[id]
+	if !ok || m.unlockState(profile, c) == Locked {
+		return false
+	}
+	setStoredState(profile, m.name, id, state)
+	return true
+}
+
+// Available returns the learned recipes profile can craft at station, sorted
+// by ID. Recipes without a station can be crafted at any station.
+func (m *Manager) Available(profile, station string) []Craftable {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var results []Craftable
+	for _, c := range m.craftables {
+		if c.Station != "" && c.Station != station {
+			continue
+		}
+		if m.unlockState(profile, c) != Learned {
+			continue
+		}
+		results = append(results, c)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
+
+// AvailableIDs returns the IDs of the recipes returned by Available
+func (m *Manager) AvailableIDs(profile, station string) []string {
+	available := m.Available(profile, station)
+	ids := make([]string, len(available))
+	for i, c := range available {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// IterateAvailable points the shared iterator at the IDs returned by Available
+func (m *Manager) IterateAvailable(profile, station string) int {
+	ids := m.AvailableIDs(profile, station)
+	setCraftIter(ids)
+	return len(ids)
+}
+
+// ResetUnlocks forgets the unlock progress of every profile
+func ResetUnlocks() {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	unlocks = make(map[string]map[string]map[string]UnlockState)
+}
+
+// LoadUnlocks replaces all unlock progress with the saved data
+func LoadUnlocks(data json.RawMessage) error {
+	loaded := make(map[string]map[string]map[string]UnlockState)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to unmarshal crafting unlocks: %w", err)
+	}
+
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	unlocks = loaded
+	return nil
+}
+
+// SaveUnlocks returns the unlock progress of every profile
+func SaveUnlocks() (any, error) {
+	unlockMu.RLock()
+	defer unlockMu.RUnlock()
+
+	b, err := json.Marshal(unlocks)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
@@ -0,0 +1,353 @@
+package crafting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrorKind classifies a problem found while validating recipes
+type ErrorKind int
+
+const (
+	DuplicateID ErrorKind = iota
+	DuplicateRequirement
+	InvalidQuantity
+	UnknownItem
+	Cycle
+	// UncheckedItems notes that no items were known, so references to
+	// unknown items could not be checked. It never refuses a manager.
+	UncheckedItems
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case DuplicateID:
+		return "duplicate id"
+	case DuplicateRequirement:
+		return "duplicate requirement"
+	case InvalidQuantity:
+		return "invalid quantity"
+	case UnknownItem:
+		return "unknown item"
+	case Cycle:
+		return "cycle"
+	case UncheckedItems:
+		return "unchecked items"
+	}
+	return "unknown error"
+}
+
+// ValidationError describes a single problem in one craftable of a manager
+type ValidationError struct {
+	Manager string
+	CraftID string
+	Kind    ErrorKind
+	Detail  string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s/%s: %s: %s", e.Manager, e.CraftID, e.Kind, e.Detail)
+}
+
+// ValidationErrors is the full list of problems found by a validation pass
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// refuses reports whether errs holds more than notices, which strict mode
+// refuses a manager for
+func (errs ValidationErrors) refuses() bool {
+	for _, e := range errs {
+		if e.Kind != UncheckedItems {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	knownItems = make(map[string]struct{})
+	itemSource func() []string
+	strict     bool
+	lastErrors ValidationErrors
+
+	// loaded holds the managers of the last LoadManagers call, refused those
+	// strict mode didn't register; both are replaced, never changed in place
+	loaded  map[string][]Craftable
+	refused map[string]bool
+)
+
+// SetStrict makes LoadManagers refuse to register managers that fail validation
+func SetStrict(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	strict = enabled
+}
+
+// AddKnownItems registers base item IDs that recipes may require without
+// being craftable themselves. While no items are known, from here or from the
+// item source, unknown references are reported as a single UncheckedItems
+// notice per manager instead.
+func AddKnownItems(ids ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		knownItems[id] = struct{}{}
+	}
+}
+
+// SetItemSource sets a function listing the defined item IDs, which are
+// known in addition to those added with AddKnownItems. The equipment package
+// uses it to offer its loaded item definitions and calls Revalidate when they
+// load.
+func SetItemSource(fn func() []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	itemSource = fn
+}
+
+// ResetKnownItems forgets every registered base item
+func ResetKnownItems() {
+	mu.Lock()
+	defer mu.Unlock()
+	knownItems = make(map[string]struct{})
+}
+
+// Revalidate validates the managers of the last LoadManagers call again with
+// the items known now, so the outcome doesn't depend on whether recipes or
+// item definitions load first. In strict mode managers that now pass are
+// registered and managers that now fail are removed; managers whose outcome
+// didn't change are left alone. Problems are returned and kept like those of
+// LoadManagers.
+func Revalidate() error {
+	mu.RLock()
+	managers := loaded
+	mu.RUnlock()
+	if managers == nil {
+		return nil
+	}
+	return registerManagers(managers, true)
+}
+
+// registerManagers validates managers and registers those strict mode
+// accepts. Revalidating only changes managers whose outcome changed since
+// they were loaded.
+func registerManagers(managers map[string][]Craftable, again bool) error {
+	names := make([]string, 0, len(managers))
+	for name := range managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mu.RLock()
+	refuse := strict
+	wasRefused := refused
+	mu.RUnlock()
+
+	var all ValidationErrors
+	nowRefused := make(map[string]bool)
+	for _, name := range names {
+		craftables := managers[name]
+		errs := Validate(name, craftables)
+		all = append(all, errs...)
+		if refuse && errs.refuses() {
+			nowRefused[name] = true
+			if again && !wasRefused[name] {
+				mu.Lock()
+				delete(registry, name)
+				mu.Unlock()
+			}
+			continue
+		}
+		if again && !wasRefused[name] {
+			continue
+		}
+
+		m := NewManager()
+		for _, c := range craftables {
+			m.add(c)
+		}
+		Register(name, m)
+	}
+
+	mu.Lock()
+	loaded, refused = managers, nowRefused
+	lastErrors = all
+	mu.Unlock()
+
+	if all.refuses() {
+		return all
+	}
+	return nil
+}
+
+// forgetLoadedLocked keeps Revalidate from bringing back a reset manager;
+// mu must be held
+func forgetLoadedLocked(name string) {
+	if _, ok := loaded[name]; !ok {
+		return
+	}
+	kept := make(map[string][]Craftable, len(loaded))
+	for k, v := range loaded {
+		if k != name {
+			kept[k] = v
+		}
+	}
+	loaded = kept
+}
+
+// LastValidationErrors returns the problems reported by the last LoadManagers call
+func LastValidationErrors() ValidationErrors {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append(ValidationErrors(nil), lastErrors...)
+}
+
+// Validate checks the recipe list of a manager for duplicate IDs, duplicate
+// or non-positive requirements, unknown items and cycles. Items are known if
+// a recipe produces them, they were added with AddKnownItems or the item
+// source lists them. A requirement with
+// an empty ID marks a recipe without prerequisites and is always accepted.
+func Validate(name string, craftables []Craftable) ValidationErrors {
+	mu.RLock()
+	known := make(map[string]struct{}, len(knownItems))
+	for id := range knownItems {
+		known[id] = struct{}{}
+	}
+	source := itemSource
+	mu.RUnlock()
+	if source != nil {
+		for _, id := range source() {
+			known[id] = struct{}{}
+		}
+	}
+
+	var errs ValidationErrors
+	report := func(id string, kind ErrorKind, format string, args ...any) {
+		errs = append(errs, ValidationError{
+			Manager: name,
+			CraftID: id,
+			Kind:    kind,
+			Detail:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	defined := make(map[string]Craftable, len(craftables))
+	produces := make(map[string][]string)
+	for _, c := range craftables {
+		if _, dup := defined[c.ID]; dup {
+			report(c.ID, DuplicateID, "defined more than once")
+			continue
+		}
+		defined[c.ID] = c
+		output := c.Output
+		if output == "" {
+			output = c.ID
+		}
+		produces[output] = append(produces[output], c.ID)
+	}
+
+	unchecked := 0
+	seen := make(map[string]struct{}, len(craftables))
+	for _, c := range craftables {
+		if _, dup := seen[c.ID]; dup {
+			continue
+		}
+		seen[c.ID] = struct{}{}
+
+		reqs := make(map[string]struct{}, len(c.Requirements))
+		for _, req := range c.Requirements {
+			if req.ID == "" {
+				continue
+			}
+			if _, dup := reqs[req.ID]; dup {
+				report(c.ID, DuplicateRequirement, "requires %q more than once", req.ID)
+				continue
+			}
+			reqs[req.ID] = struct{}{}
+
+			if req.Qty <= 0 {
+				report(c.ID, InvalidQuantity, "requires %d of %q", req.Qty, req.ID)
+			}
+			_, craftable := produces[req.ID]
+			_, base := known[req.ID]
+			switch {
+			case craftable || base:
+			case len(known) == 0:
+				unchecked++
+			default:
+				report(c.ID, UnknownItem, "requires unknown item %q", req.ID)
+			}
+		}
+	}
+	if unchecked > 0 {
+		report("", UncheckedItems, "no items are known, %d references to items that are not craftable were not checked", unchecked)
+	}
+
+	for _, cycle := range findCycles(defined, produces) {
+		report(cycle[0], Cycle, "%s", strings.Join(cycle, " -> "))
+	}
+
+	return errs
+}
+
+// findCycles walks the requirement graph in sorted order and returns every
+// cycle it closes, each starting and ending with the same craft ID. A recipe
+// depends on every recipe producing one of its requirements.
+func findCycles(defined map[string]Craftable, produces map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	ids := make([]string, 0, len(defined))
+	for id := range defined {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	state := make(map[string]int, len(defined))
+	var path []string
+	var cycles [][]string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		path = append(path, id)
+		for _, req := range defined[id].Requirements {
+			for _, next := range produces[req.ID] {
+				switch state[next] {
+				case unvisited:
+					visit(next)
+				case visiting:
+					start := 0
+					for i, p := range path {
+						if p == next {
+							start = i
+							break
+						}
+					}
+					cycle := append([]string(nil), path[start:]...)
+					cycles = append(cycles, append(cycle, next))
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
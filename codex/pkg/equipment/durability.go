@@ -0,0 +1,300 @@
+package equipment
+
+import (
+	"codex/pkg/crafting"
+	"sort"
+)
+
+// Items with a MaxDurability lose durability as they wear. Wear belongs to
+// the equipped copy of an item: it is kept per slot position and moves with
+// the item when positions are swapped, so two copies of an item wear
+// independently. A worn copy that leaves its slot, however it leaves, takes
+// its wear along: the manager keeps it per item ID and the next copy of that
+// item equipped gets the wear of the last one that left. Only Repair restores
+// durability. Functions taking an item ID act on its first equipped copy, in
+// slot type order.
+
+// RepairResult is the reason code returned by Repair
+type RepairResult int
+
+const (
+	RepairOK           RepairResult = iota
+	RepairNoDurability              // the item never wears
+	RepairNotNeeded                 // the item is undamaged
+	RepairCannotAfford              // the stock can't pay the repair materials
+	RepairNotEquipped               // no copy of the item is equipped there
+)
+
+func (r RepairResult) String() string {
+	switch r {
+	case RepairOK:
+		return "ok"
+	case RepairNoDurability:
+		return "no durability"
+	case RepairNotNeeded:
+		return "not needed"
+	case RepairCannotAfford:
+		return "cannot afford"
+	case RepairNotEquipped:
+		return "not equipped"
+	}
+	return "unknown result"
+}
+
+// broken reports whether the item at index has worn down to zero durability
+func (s *SlotConfig) broken(index int) bool {
+	d, ok := s.wear[index]
+	return ok && d <= 0
+}
+
+// durability returns the remaining durability of the item at index, capped
+// at the maximum of its definition
+func (s *SlotConfig) durability(index int, def ItemDef) float64 {
+	if d, ok := s.wear[index]; ok && d < def.MaxDurability {
+		return d
+	}
+	return def.MaxDurability
+}
+
+// locateLocked returns the slot and position of the first equipped copy of
+// itemID, or nil; em.mu must be held
+func (em *EquipmentManager) locateLocked(itemID string) (*SlotConfig, int) {
+	slotTypes := make([]string, 0, len(em.slots))
+	for slotType := range em.slots {
+		slotTypes = append(slotTypes, slotType)
+	}
+	sort.Strings(slotTypes)
+	for _, slotType := range slotTypes {
+		slot := em.slots[slotType]
+		if i := slot.indexOf(itemID); i >= 0 {
+			return slot, i
+		}
+	}
+	return nil, -1
+}
+
+// positionLocked returns the slot of slotType when index holds an item, or
+// nil; em.mu must be held
+func (em *EquipmentManager) positionLocked(slotType string, index int) *SlotConfig {
+	slot, exists := em.slots[slotType]
+	if !exists || slot.at(index) == "" {
+		return nil
+	}
+	return slot
+}
+
+// placeLocked puts itemID at index of slot, giving it the wear of the last
+// worn copy that left; em.mu must be held for writing
+func (em *EquipmentManager) placeLocked(slot *SlotConfig, index int, itemID string) {
+	slot.place(index, itemID)
+	worn := em.worn[itemID]
+	if len(worn) == 0 {
+		return
+	}
+	slot.setWear(index, worn[len(worn)-1])
+	if len(worn) == 1 {
+		delete(em.worn, itemID)
+	} else {
+		em.worn[itemID] = worn[:len(worn)-1]
+	}
+}
+
+// removeLocked empties the position at index of slot, keeping the wear of
+// its item; em.mu must be held for writing
+func (em *EquipmentManager) removeLocked(slot *SlotConfig, index int) {
+	em.stowLocked(slot, index)
+	slot.remove(index)
+}
+
+// truncateLocked empties every position of slot from n on, keeping the wear
+// of their items; em.mu must be held for writing
+func (em *EquipmentManager) truncateLocked(slot *SlotConfig, n int) {
+	for i := n; i < len(slot.ItemIDS); i++ {
+		em.stowLocked(slot, i)
+	}
+	slot.truncate(n)
+}
+
+// stowLocked keeps the wear of the item at index of slot; em.mu must be held
+// for writing
+func (em *EquipmentManager) stowLocked(slot *SlotConfig, index int) {
+	itemID := slot.at(index)
+	d, worn := slot.wear[index]
+	if itemID == "" || !worn {
+		return
+	}
+	if em.worn == nil {
+		em.worn = make(map[string][]float64)
+	}
+	em.worn[itemID] = append(em.worn[itemID], d)
+}
+
+// Durability returns the remaining durability of the first equipped copy of
+// an item. Undamaged and unequipped items report their maximum; items that
+// never wear report 0.
+func (em *EquipmentManager) Durability(itemID string) float64 {
+	def, _ := GetItem(itemID)
+
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	slot, i := em.locateLocked(itemID)
+	if slot == nil {
+		return def.MaxDurability
+	}
+	return slot.durability(i, def)
+}
+
+// DurabilityAt returns the remaining durability of the item in a position,
+// or 0 if the position is empty
+func (em *EquipmentManager) DurabilityAt(slotType string, index int) float64 {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	slot := em.positionLocked(slotType, index)
+	if slot == nil {
+		return 0
+	}
+	def, _ := GetItem(slot.at(index))
+	return slot.durability(index, def)
+}
+
+// IsBroken reports whether the first equipped copy of an item has worn down
+// to zero durability
+func (em *EquipmentManager) IsBroken(itemID string) bool {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	slot, i := em.locateLocked(itemID)
+	return slot != nil && slot.broken(i)
+}
+
+// IsBrokenAt reports whether the item in a position is broken
+func (em *EquipmentManager) IsBrokenAt(slotType string, index int) bool {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	slot := em.positionLocked(slotType, index)
+	return slot != nil && slot.broken(index)
+}
+
+// ApplyWear reduces the durability of every item equipped in slotType by
+// amount and returns the items that broke. Broken items whose definition
+// sets BreakUnequips are removed from the slot and stay broken; handing them
+// back to an inventory is left to the caller.
+func (em *EquipmentManager) ApplyWear(slotType string, amount float64) []string {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, exists := em.slots[slotType]
+	if !exists || amount <= 0 {
+		return nil
+	}
+
+	var broken []string
+	for i, id := range append([]string(nil), slot.ItemIDS...) {
+		if id != "" && em.wearLocked(slot, i, amount) {
+			broken = append(broken, id)
+		}
+	}
+	if len(broken) > 0 {
+		em.recalcStats()
+	}
+	return broken
+}
+
+// ApplyItemWear reduces the durability of the first equipped copy of an
+// item by amount and reports whether it broke
+func (em *EquipmentManager) ApplyItemWear(itemID string, amount float64) bool {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, i := em.locateLocked(itemID)
+	return em.wearAtLocked(slot, i, amount)
+}
+
+// ApplyWearAt reduces the durability of the item in a position by amount
+// and reports whether it broke
+func (em *EquipmentManager) ApplyWearAt(slotType string, index int, amount float64) bool {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	return em.wearAtLocked(em.positionLocked(slotType, index), index, amount)
+}
+
+// wearAtLocked damages a single item, refreshing stats when it broke; em.mu
+// must be held for writing
+func (em *EquipmentManager) wearAtLocked(slot *SlotConfig, index int, amount float64) bool {
+	if slot == nil || amount <= 0 || !em.wearLocked(slot, index, amount) {
+		return false
+	}
+	em.recalcStats()
+	return true
+}
+
+// wearLocked damages the item at index of slot and reports whether this
+// broke it; em.mu must be held for writing
+func (em *EquipmentManager) wearLocked(slot *SlotConfig, index int, amount float64) bool {
+	itemID := slot.at(index)
+	def, _ := GetItem(itemID)
+	if def.MaxDurability <= 0 || slot.broken(index) {
+		return false
+	}
+
+	d := slot.durability(index, def) - amount
+	if d < 0 {
+		d = 0
+	}
+	slot.setWear(index, d)
+	if d > 0 {
+		return false
+	}
+
+	if def.BreakUnequips {
+		em.removeLocked(slot, index)
+		delete(em.bagItems, itemID)
+	}
+	return true
+}
+
+// Repair restores the first equipped copy of an item to full durability,
+// paying its repair materials from stock. Nothing is consumed unless the
+// repair happens.
+func (em *EquipmentManager) Repair(itemID string, stock crafting.Stock) RepairResult {
+	def, _ := GetItem(itemID)
+	if def.MaxDurability <= 0 {
+		return RepairNoDurability
+	}
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, i := em.locateLocked(itemID)
+	return em.repairLocked(slot, i, stock)
+}
+
+// RepairAt restores the item in a position to full durability like Repair
+func (em *EquipmentManager) RepairAt(slotType string, index int, stock crafting.Stock) RepairResult {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	return em.repairLocked(em.positionLocked(slotType, index), index, stock)
+}
+
+// repairLocked repairs the item at index of slot; em.mu must be held for
+// writing
+func (em *EquipmentManager) repairLocked(slot *SlotConfig, index int, stock crafting.Stock) RepairResult {
+	if slot == nil {
+		return RepairNotEquipped
+	}
+	def, _ := GetItem(slot.at(index))
+	if def.MaxDurability <= 0 {
+		return RepairNoDurability
+	}
+	if slot.durability(index, def) >= def.MaxDurability {
+		return RepairNotNeeded
+	}
+	if !crafting.Pay(def.Repair, stock) {
+		return RepairCannotAfford
+	}
+
+	delete(slot.wear, index)
+	em.recalcStats()
+	return RepairOK
+}
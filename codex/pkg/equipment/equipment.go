@@ -2,27 +2,167 @@
 package equipment
 
 import (
+	"codex/pkg/inventory"
 	"codex/pkg/iterator"
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // SlotConfig defines configuration for an equipment slot
 type SlotConfig struct {
-	ItemIDS  []string // List of currently equipped item IDs (empty slice = no items)
+	ItemIDS  []string // Equipped item IDs by position; "" and positions past the end are empty
 	MaxSlots int      // Maximum number of items that can be equipped in this slot type
+
+	wear map[int]float64 // position -> remaining durability of a worn item; absent means undamaged
+}
+
+// count returns the number of occupied positions
+func (s *SlotConfig) count() int {
+	n := 0
+	for _, id := range s.ItemIDS {
+		if id != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// items returns the occupied positions in order
+func (s *SlotConfig) items() []string {
+	result := make([]string, 0, len(s.ItemIDS))
+	for _, id := range s.ItemIDS {
+		if id != "" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// at returns the item at index, or "" if the position is empty
+func (s *SlotConfig) at(index int) string {
+	if index < 0 || index >= len(s.ItemIDS) {
+		return ""
+	}
+	return s.ItemIDS[index]
+}
+
+// freeIndex returns the first empty position, or -1 if the slot is full
+func (s *SlotConfig) freeIndex() int {
+	for i := 0; i < s.MaxSlots; i++ {
+		if s.at(i) == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOf returns the position holding itemID, or -1
+func (s *SlotConfig) indexOf(itemID string) int {
+	for i, id := range s.ItemIDS {
+		if id != "" && id == itemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// place puts a fresh copy of itemID at index, which must be below MaxSlots
+func (s *SlotConfig) place(index int, itemID string) {
+	for len(s.ItemIDS) <= index {
+		s.ItemIDS = append(s.ItemIDS, "")
+	}
+	s.ItemIDS[index] = itemID
+	delete(s.wear, index)
+	s.trim()
+}
+
+// remove empties the position at index, dropping the wear of its item;
+// managers keep it with removeLocked
+func (s *SlotConfig) remove(index int) {
+	s.ItemIDS[index] = ""
+	delete(s.wear, index)
+	s.trim()
+}
+
+// swap exchanges two positions together with the wear of their items
+func (s *SlotConfig) swap(i, j int) {
+	a, b := s.at(i), s.at(j)
+	wa, worn := s.wear[i]
+	wb, wornB := s.wear[j]
+	s.place(i, b)
+	s.place(j, a)
+	if wornB {
+		s.setWear(i, wb)
+	}
+	if worn {
+		s.setWear(j, wa)
+	}
+}
+
+// truncate empties every position from n on
+func (s *SlotConfig) truncate(n int) {
+	if len(s.ItemIDS) > n {
+		s.ItemIDS = s.ItemIDS[:n]
+	}
+	for index := range s.wear {
+		if index >= n {
+			delete(s.wear, index)
+		}
+	}
+	s.trim()
+}
+
+// setWear records the remaining durability of the item at index
+func (s *SlotConfig) setWear(index int, d float64) {
+	if s.wear == nil {
+		s.wear = make(map[int]float64)
+	}
+	s.wear[index] = d
+}
+
+// clone returns an independent copy of the slot
+func (s *SlotConfig) clone() *SlotConfig {
+	c := &SlotConfig{
+		ItemIDS:  append([]string{}, s.ItemIDS...),
+		MaxSlots: s.MaxSlots,
+	}
+	for index, d := range s.wear {
+		c.setWear(index, d)
+	}
+	return c
+}
+
+// trim drops trailing empty positions
+func (s *SlotConfig) trim() {
+	for len(s.ItemIDS) > 0 && s.ItemIDS[len(s.ItemIDS)-1] == "" {
+		s.ItemIDS = s.ItemIDS[:len(s.ItemIDS)-1]
+	}
 }
 
 // EquipmentManager manages equipment slots with runtime-configurable slot types
 type EquipmentManager struct {
+	ID        int
+	lockKey   uint64 // unique per manager, orders locks taken on two managers
 	mu        sync.RWMutex
 	slots     map[string]*SlotConfig // slotType -> SlotConfig
 	iterIndex int
 	iterItems []string
+
+	baseStats    map[string]float64
+	stats        map[string]float64 // cached totals, rebuilt on every change
+	statsVersion int                // item definitions version the cache was built from
+	setPieces    map[string]int     // setID -> equipped pieces
+	setEvents    []SetEvent         // pending set bonus changes, oldest first
+	lastSetEvent SetEvent
+
+	bagItems map[string]inventory.Item // stack settings of items equipped from an inventory
+	worn     map[string][]float64      // item ID -> durability of worn copies that left their slot
 }
 
 // Global equipment manager instance
 var globalManager *EquipmentManager
+var lastLockKey uint64
 var once sync.Once
 var equipmentIter *iterator.Iterator[string]
 
@@ -34,39 +174,109 @@ func GetManager() *EquipmentManager {
 	return globalManager
 }
 
+// Equipment manager instances addressed by ID; ID 0 is the global manager
+var (
+	instances   = make(map[int]*EquipmentManager)
+	nextID      = 1
+	instancesMu sync.RWMutex
+)
+
+// NewManagerInstance creates a new equipment manager and returns its ID
+func NewManagerInstance() int {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	id := nextID
+	nextID++
+	em := NewEquipmentManager()
+	em.ID = id
+	instances[id] = em
+	return id
+}
+
+// GetInstance returns an equipment manager by ID, or nil if it doesn't exist
+func GetInstance(id int) *EquipmentManager {
+	if id == 0 {
+		return GetManager()
+	}
+	instancesMu.RLock()
+	defer instancesMu.RUnlock()
+	return instances[id]
+}
+
+// RemoveInstance deletes an equipment manager created by NewManagerInstance
+func RemoveInstance(id int) bool {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	if _, exists := instances[id]; !exists {
+		return false
+	}
+	delete(instances, id)
+	return true
+}
+
 // NewEquipmentManager creates a new equipment manager
 func NewEquipmentManager() *EquipmentManager {
 	return &EquipmentManager{
+		lockKey:   atomic.AddUint64(&lastLockKey, 1),
 		slots:     make(map[string]*SlotConfig),
 		iterIndex: 0,
+		baseStats: make(map[string]float64),
 	}
 }
 
 // DefineSlot defines a new slot type with its maximum capacity
 // If the slot type already exists, it updates the MaxSlots but keeps the current ItemIDS
-// Returns true on success, false on failure
+// Returns true on success, false on failure. A slot can't shrink over
+// equipped items; use ResizeSlot to evict them.
 func (em *EquipmentManager) DefineSlot(slotType string, maxSlots int) bool {
+	_, ok := em.resize(slotType, maxSlots, false)
+	return ok
+}
+
+// ResizeSlot defines or resizes a slot type like DefineSlot and returns the
+// items that were equipped in positions beyond the new size
+func (em *EquipmentManager) ResizeSlot(slotType string, maxSlots int) ([]string, bool) {
+	return em.resize(slotType, maxSlots, true)
+}
+
+// resize defines or resizes a slot type, refusing to shrink over equipped
+// items unless evict is set
+func (em *EquipmentManager) resize(slotType string, maxSlots int, evict bool) ([]string, bool) {
 	if maxSlots < 1 {
-		return false
+		return nil, false
 	}
 
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
-	if existing, exists := em.slots[slotType]; exists {
-		// Update max slots but keep current items
-		existing.MaxSlots = maxSlots
-		if len(existing.ItemIDS) > maxSlots {
-			existing.ItemIDS = existing.ItemIDS[:maxSlots]
-		}
-	} else {
+	existing, exists := em.slots[slotType]
+	if exists && !evict && len(existing.ItemIDS) > maxSlots {
+		return nil, false
+	}
+	if !exists {
 		em.slots[slotType] = &SlotConfig{
 			ItemIDS:  make([]string, 0),
 			MaxSlots: maxSlots,
 		}
+		return nil, true
 	}
 
-	return true
+	// Update max slots but keep current items
+	existing.MaxSlots = maxSlots
+	var evicted []string
+	if len(existing.ItemIDS) > maxSlots {
+		for _, id := range existing.ItemIDS[maxSlots:] {
+			if id != "" {
+				evicted = append(evicted, id)
+			}
+		}
+		em.truncateLocked(existing, maxSlots)
+		em.forgetLocked(evicted)
+		if len(evicted) > 0 {
+			em.recalcStats()
+		}
+	}
+	return evicted, true
 }
 
 // RemoveSlotDefinition removes a slot type definition entirely
@@ -74,39 +284,119 @@ func (em *EquipmentManager) RemoveSlotDefinition(slotType string) bool {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
-	if _, exists := em.slots[slotType]; !exists {
+	slot, exists := em.slots[slotType]
+	if !exists {
 		return false
 	}
 
+	evicted := slot.items()
+	em.truncateLocked(slot, 0)
 	delete(em.slots, slotType)
+	em.forgetLocked(evicted)
+	em.recalcStats()
 	return true
 }
 
-// EquipItem equips an item to the specified slot type
+// forgetLocked drops the stack settings of evicted items; em.mu must be held
+// for writing. Their wear is kept for when they are equipped again.
+func (em *EquipmentManager) forgetLocked(evicted []string) {
+	for _, id := range evicted {
+		delete(em.bagItems, id)
+	}
+}
+
+// EquipItem equips an item to the specified slot type.
+// Use Equip to learn why equipping failed.
 func (em *EquipmentManager) EquipItem(slotType string, itemID string) bool {
-	if itemID == "" {
-		return false
+	return em.Equip(slotType, itemID) == EquipOK
+}
+
+// Equip equips an item to the specified slot type and returns EquipOK, or
+// the first rule that prevented it
+func (em *EquipmentManager) Equip(slotType string, itemID string) EquipResult {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	if res := em.checkEquip(slotType, itemID); res != EquipOK {
+		return res
 	}
 
+	slot := em.slots[slotType]
+	em.placeLocked(slot, slot.freeIndex(), itemID)
+	em.recalcStats()
+	return EquipOK
+}
+
+// EquipAt equips an item into a specific empty position of a slot type
+func (em *EquipmentManager) EquipAt(slotType string, index int, itemID string) EquipResult {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
 	slot, exists := em.slots[slotType]
 	if !exists {
-		return false
+		return EquipUnknownSlot
+	}
+	if index < 0 || index >= slot.MaxSlots {
+		return EquipBadPosition
+	}
+	if slot.at(index) != "" {
+		return EquipPositionOccupied
 	}
 
-	if len(slot.ItemIDS) >= slot.MaxSlots {
-		return false
+	res := em.checkEquip(slotType, itemID)
+	if res != EquipOK && res != EquipSlotFull {
+		return res
 	}
 
-	for _, id := range slot.ItemIDS {
-		if id == itemID {
-			return false // already equipped
-		}
+	em.placeLocked(slot, index, itemID)
+	em.recalcStats()
+	return EquipOK
+}
+
+// GetAt returns the item in a position of a slot type, or "" if it is empty
+func (em *EquipmentManager) GetAt(slotType string, index int) string {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	slot, exists := em.slots[slotType]
+	if !exists {
+		return ""
 	}
+	return slot.at(index)
+}
 
-	slot.ItemIDS = append(slot.ItemIDS, itemID)
+// UnequipAt empties a position of a slot type and returns the item it held
+func (em *EquipmentManager) UnequipAt(slotType string, index int) string {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, exists := em.slots[slotType]
+	if !exists {
+		return ""
+	}
+	itemID := slot.at(index)
+	if itemID == "" {
+		return ""
+	}
+	em.removeLocked(slot, index)
+	em.recalcStats()
+	return itemID
+}
+
+// SwapWithin exchanges two positions of a slot type; either may be empty
+func (em *EquipmentManager) SwapWithin(slotType string, i, j int) bool {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, exists := em.slots[slotType]
+	if !exists {
+		return false
+	}
+	if i < 0 || j < 0 || i >= slot.MaxSlots || j >= slot.MaxSlots {
+		return false
+	}
+
+	slot.swap(i, j)
 	return true
 }
 
@@ -120,17 +410,17 @@ func (em *EquipmentManager) UnequipItem(slotType string, itemID string) bool {
 		return false
 	}
 
-	for i, id := range slot.ItemIDS {
-		if id == itemID {
-			slot.ItemIDS = append(slot.ItemIDS[:i], slot.ItemIDS[i+1:]...)
-			return true
-		}
+	i := slot.indexOf(itemID)
+	if i < 0 {
+		return false
 	}
-
-	return false
+	em.removeLocked(slot, i)
+	em.recalcStats()
+	return true
 }
 
-// GetEquippedItems returns all item IDs for a slot
+// GetEquippedItems returns all item IDs for a slot in position order,
+// skipping empty positions
 func (em *EquipmentManager) GetEquippedItems(slotType string) []string {
 	em.mu.RLock()
 	defer em.mu.RUnlock()
@@ -140,9 +430,7 @@ func (em *EquipmentManager) GetEquippedItems(slotType string) []string {
 		return []string{}
 	}
 
-	result := make([]string, len(slot.ItemIDS))
-	copy(result, slot.ItemIDS)
-	return result
+	return slot.items()
 }
 
 // IsSlotEmpty returns true if no items are equipped
@@ -160,7 +448,7 @@ func (em *EquipmentManager) IsSlotFull(slotType string) bool {
 		return false
 	}
 
-	return len(slot.ItemIDS) >= slot.MaxSlots
+	return slot.count() >= slot.MaxSlots
 }
 
 // IsItemEquipped checks if item is in slot
@@ -178,12 +466,71 @@ func (em *EquipmentManager) GetAllEquippedItems() []string {
 	em.mu.RLock()
 	defer em.mu.RUnlock()
 
-	var result []string
-	for _, slot := range em.slots {
-		result = append(result, slot.ItemIDS...)
+	return em.equippedLocked()
+}
+
+// CopyLoadoutFrom replaces slot definitions, equipped items, item wear and
+// the stack settings of items equipped from an inventory with a copy of src
+func (em *EquipmentManager) CopyLoadoutFrom(src *EquipmentManager) {
+	if em == src {
+		return
 	}
+	slots, bagItems, worn := src.cloneLoadout()
 
-	return result
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.slots = slots
+	em.bagItems = bagItems
+	em.worn = worn
+	em.recalcStats()
+}
+
+// SwapLoadouts exchanges slot definitions, equipped items, item wear and
+// stack settings of a and b
+func SwapLoadouts(a, b *EquipmentManager) {
+	if a == b {
+		return
+	}
+	// Lock in a stable order so concurrent swaps can't deadlock
+	first, second := a, b
+	if b.lockKey < a.lockKey {
+		first, second = b, a
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	a.slots, b.slots = b.slots, a.slots
+	a.bagItems, b.bagItems = b.bagItems, a.bagItems
+	a.worn, b.worn = b.worn, a.worn
+	a.recalcStats()
+	b.recalcStats()
+}
+
+func (em *EquipmentManager) cloneLoadout() (map[string]*SlotConfig, map[string]inventory.Item, map[string][]float64) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	slots := make(map[string]*SlotConfig, len(em.slots))
+	for slotType, slot := range em.slots {
+		slots[slotType] = slot.clone()
+	}
+	var bagItems map[string]inventory.Item
+	if len(em.bagItems) > 0 {
+		bagItems = make(map[string]inventory.Item, len(em.bagItems))
+		for id, item := range em.bagItems {
+			bagItems[id] = item
+		}
+	}
+	var worn map[string][]float64
+	if len(em.worn) > 0 {
+		worn = make(map[string][]float64, len(em.worn))
+		for id, ds := range em.worn {
+			worn[id] = append([]float64(nil), ds...)
+		}
+	}
+	return slots, bagItems, worn
 }
 
 // ResetIterator resets item iterator
@@ -194,7 +541,7 @@ func (em *EquipmentManager) ResetIterator() {
 	em.iterIndex = 0
 	em.iterItems = nil
 	for _, slot := range em.slots {
-		em.iterItems = append(em.iterItems, slot.ItemIDS...)
+		em.iterItems = append(em.iterItems, slot.items()...)
 	}
 	sort.Strings(em.iterItems)
 }
@@ -231,8 +578,9 @@ func (em *EquipmentManager) Clear() {
 	defer em.mu.Unlock()
 
 	for _, slot := range em.slots {
-		slot.ItemIDS = slot.ItemIDS[:0]
+		em.truncateLocked(slot, 0)
 	}
+	em.recalcStats()
 }
 
 // ClearSlot removes all items from a slot
@@ -245,16 +593,19 @@ func (em *EquipmentManager) ClearSlot(slotType string) bool {
 		return false
 	}
 
-	slot.ItemIDS = slot.ItemIDS[:0]
+	em.truncateLocked(slot, 0)
+	em.recalcStats()
 	return true
 }
 
-// Reset removes all slots
+// Reset removes all slots and forgets item wear
 func (em *EquipmentManager) Reset() {
 	em.mu.Lock()
 	defer em.mu.Unlock()
 
 	em.slots = make(map[string]*SlotConfig)
+	em.worn = nil
+	em.recalcStats()
 }
 
 // GetSlotAvailability returns remaining capacity
@@ -267,7 +618,7 @@ func (em *EquipmentManager) GetSlotAvailability(slotType string) int {
 		return 0
 	}
 
-	return slot.MaxSlots - len(slot.ItemIDS)
+	return slot.MaxSlots - slot.count()
 }
 
 // HasAnyEmptySlot returns true if at least one defined slot has available capacity
@@ -276,13 +627,65 @@ func (em *EquipmentManager) HasAnyEmptySlot() bool {
 	defer em.mu.RUnlock()
 
 	for _, slot := range em.slots {
-		if len(slot.ItemIDS) < slot.MaxSlots {
+		if slot.count() < slot.MaxSlots {
 			return true
 		}
 	}
 	return false
 }
 
+var iters = iterator.NewHandles[string]()
+
+// OpenItemsIter starts an independent iteration over the sorted items equipped
+// in manager id and returns its handle, or 0 if the manager doesn't exist
+func OpenItemsIter(id int) int {
+	em := GetInstance(id)
+	if em == nil {
+		return 0
+	}
+	items := em.GetAllEquippedItems()
+	sort.Strings(items)
+	return iters.Open(items)
+}
+
+// OpenSlotsIter starts an independent iteration over the sorted slot types of
+// manager id and returns its handle, or 0 if the manager doesn't exist
+func OpenSlotsIter(id int) int {
+	em := GetInstance(id)
+	if em == nil {
+		return 0
+	}
+	slotTypes := em.GetAllSlotTypes()
+	sort.Strings(slotTypes)
+	return iters.Open(slotTypes)
+}
+
+// OpenActiveSetsIter starts an independent iteration over the active sets of
+// manager id and returns its handle, or 0 if the manager doesn't exist
+func OpenActiveSetsIter(id int) int {
+	em := GetInstance(id)
+	if em == nil {
+		return 0
+	}
+	return iters.Open(em.ActiveSetIDs())
+}
+
+// OpenListIter starts an independent iteration over values and returns its handle
+func OpenListIter(values []string) int {
+	return iters.Open(values)
+}
+
+// IterNext returns the next value of handle, or "" once it is exhausted
+func IterNext(handle int) string {
+	val, _ := iters.Next(handle)
+	return val
+}
+
+// CloseIter releases handle
+func CloseIter(handle int) {
+	iters.Close(handle)
+}
+
 func InitGetAllEquippedItemsIter(){
 	allItems := GetManager().GetAllEquippedItems()
 	equipmentIter = iterator.NewIterator(allItems)
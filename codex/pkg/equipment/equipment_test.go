@@ -1,10 +1,16 @@
 package equipment
 
 import (
+	"encoding/json"
 	"sort"
 	"sync"
 	"testing"
 
+	"codex/pkg/crafting"
+	"codex/pkg/inventory"
+	"codex/pkg/metrics"
+	"codex/pkg/store"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,10 +41,19 @@ func TestDefineSlot(t *testing.T) {
 
 	assert.True(t, em.EquipItem("head", "helmet1"))
 	assert.True(t, em.EquipItem("head", "helmet2"))
-	assert.True(t, em.DefineSlot("head", 1))
+	assert.False(t, em.DefineSlot("head", 1), "shrinking over equipped items needs ResizeSlot")
+	assert.Equal(t, 2, len(em.GetEquippedItems("head")))
+	assert.Equal(t, 0, em.GetSlotAvailability("head"))
 
+	evicted, ok := em.ResizeSlot("head", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"helmet2"}, evicted)
 	items := em.GetEquippedItems("head")
 	assert.Equal(t, 1, len(items))
+
+	// Growing and shrinking over empty positions still works
+	assert.True(t, em.DefineSlot("head", 3))
+	assert.True(t, em.DefineSlot("head", 1))
 }
 
 func TestRemoveSlotDefinition(t *testing.T) {
@@ -260,4 +275,636 @@ func TestEquipmentManagerIterator(t *testing.T) {
 
 	em.ResetIterator()
 	assert.Equal(t, "armor1", em.NextEquippedItem())
-}
\ No newline at end of file
+}
+func TestManagerInstances(t *testing.T) {
+	id1 := NewManagerInstance()
+	id2 := NewManagerInstance()
+	assert.NotEqual(t, id1, id2)
+
+	em1 := GetInstance(id1)
+	em2 := GetInstance(id2)
+	assert.NotNil(t, em1)
+	assert.NotSame(t, em1, em2)
+	assert.Equal(t, id1, em1.ID)
+	assert.Same(t, GetManager(), GetInstance(0))
+
+	em1.DefineSlot("weapon", 1)
+	assert.True(t, em1.EquipItem("weapon", "sword"))
+	assert.False(t, em2.IsItemEquipped("weapon", "sword"))
+
+	assert.True(t, RemoveInstance(id1))
+	assert.False(t, RemoveInstance(id1))
+	assert.Nil(t, GetInstance(id1))
+}
+
+func TestCopyAndSwapLoadouts(t *testing.T) {
+	a := GetInstance(NewManagerInstance())
+	b := GetInstance(NewManagerInstance())
+
+	a.DefineSlot("weapon", 1)
+	a.EquipItem("weapon", "sword")
+	b.DefineSlot("ring", 2)
+	b.EquipItem("ring", "ruby")
+
+	SwapLoadouts(a, b)
+	assert.Equal(t, []string{"ruby"}, a.GetEquippedItems("ring"))
+	assert.Equal(t, []string{"sword"}, b.GetEquippedItems("weapon"))
+	assert.Empty(t, a.GetEquippedItems("weapon"))
+
+	a.CopyLoadoutFrom(b)
+	assert.Equal(t, []string{"sword"}, a.GetEquippedItems("weapon"))
+	assert.Equal(t, []string{"weapon"}, a.GetAllSlotTypes())
+
+	// The copy is independent of its source
+	a.UnequipItem("weapon", "sword")
+	assert.True(t, b.IsItemEquipped("weapon", "sword"))
+}
+
+func TestSwapLoadouts_ConcurrentAndStackSettings(t *testing.T) {
+	// Plain managers share ID 0 but must still lock in a stable order
+	a, b := NewEquipmentManager(), NewEquipmentManager()
+	a.DefineSlot("weapon", 1)
+	b.DefineSlot("weapon", 1)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			SwapLoadouts(a, b)
+		}
+		close(done)
+	}()
+	for i := 0; i < 1000; i++ {
+		SwapLoadouts(b, a)
+	}
+	<-done
+
+	// Stack settings travel with the loadout
+	inv := inventory.NewInventory(2)
+	inv.AddItem(7, true, 20, 1)
+	assert.Equal(t, EquipOK, a.EquipFromInventory(inv, 0, "weapon"))
+	SwapLoadouts(a, b)
+	c := NewEquipmentManager()
+	c.CopyLoadoutFrom(b)
+
+	other := inventory.NewInventory(1)
+	other.AddItem(7, true, 20, 1)
+	assert.Equal(t, EquipOK, b.UnequipToInventory("weapon", "7", other))
+	assert.Equal(t, 2, other.CountItem(7), "stacks onto the existing item")
+
+	other = inventory.NewInventory(1)
+	other.AddItem(7, true, 20, 1)
+	assert.Equal(t, EquipOK, c.UnequipToInventory("weapon", "7", other))
+	assert.Equal(t, 2, other.CountItem(7))
+}
+
+func TestIterHandles(t *testing.T) {
+	id := NewManagerInstance()
+	em := GetInstance(id)
+	em.DefineSlot("ring", 2)
+	em.EquipItem("ring", "ruby")
+	em.EquipItem("ring", "emerald")
+
+	h1 := OpenItemsIter(id)
+	h2 := OpenSlotsIter(id)
+	assert.Equal(t, "emerald", IterNext(h1))
+	assert.Equal(t, "ring", IterNext(h2))
+	assert.Equal(t, "ruby", IterNext(h1))
+	assert.Equal(t, "", IterNext(h1))
+	CloseIter(h1)
+	CloseIter(h2)
+
+	assert.Equal(t, 0, OpenItemsIter(-1))
+}
+
+func TestStatAggregation(t *testing.T) {
+	defer ResetItems()
+	err := LoadItems([]byte(`[
+		{"id":"sword","modifiers":[{"stat":"damage","kind":"flat","value":10}]},
+		{"id":"ring","modifiers":[{"stat":"damage","kind":"percent_add","value":0.5},{"stat":"speed","kind":"flat","value":2}]},
+		{"id":"amulet","modifiers":[{"stat":"damage","kind":"mult","value":2}]}
+	]`))
+	assert.NoError(t, err)
+
+	em := NewEquipmentManager()
+	em.DefineSlot("weapon", 1)
+	em.DefineSlot("ring", 2)
+	em.SetBaseStat("damage", 5)
+	assert.Equal(t, 5.0, em.GetStat("damage"))
+
+	em.EquipItem("weapon", "sword")
+	assert.Equal(t, 15.0, em.GetStat("damage"))
+
+	em.EquipItem("ring", "ring")
+	em.EquipItem("ring", "amulet")
+	assert.Equal(t, 45.0, em.GetStat("damage"))
+	assert.Equal(t, 2.0, em.GetStat("speed"))
+
+	em.UnequipItem("ring", "ring")
+	assert.Equal(t, 30.0, em.GetStat("damage"))
+	assert.Equal(t, 0.0, em.GetStat("speed"))
+
+	// Definition changes are picked up without re-equipping
+	RegisterItem(ItemDef{ID: "sword", Modifiers: []StatModifier{{Stat: "damage", Kind: Flat, Value: 20}}})
+	assert.Equal(t, 50.0, em.GetStat("damage"))
+
+	em.Clear()
+	assert.Equal(t, 5.0, em.GetStat("damage"))
+	assert.Equal(t, map[string]float64{"damage": 5}, em.Stats())
+}
+
+func TestSetBonuses(t *testing.T) {
+	defer ResetItems()
+	defer ResetSets()
+	RegisterSet(SetDef{
+		ID:    "dragon",
+		Items: []string{"helm", "mail", "boots", "gloves"},
+		Bonuses: []SetBonus{
+			{Pieces: 4, Modifiers: []StatModifier{{Stat: "armor", Kind: Multiplier, Value: 2}}},
+			{Pieces: 2, Modifiers: []StatModifier{{Stat: "armor", Kind: Flat, Value: 10}}},
+			{Pieces: 3, Modifiers: []StatModifier{{Stat: "fire", Kind: Flat, Value: 1}}},
+		},
+	})
+
+	em := NewEquipmentManager()
+	em.DefineSlot("armor", 4)
+
+	em.EquipItem("armor", "helm")
+	assert.Equal(t, 1, em.SetPieces("dragon"))
+	assert.Empty(t, em.ActiveSets())
+	_, ok := em.PollSetEvent()
+	assert.False(t, ok)
+
+	em.EquipItem("armor", "mail")
+	assert.Equal(t, 10.0, em.GetStat("armor"))
+	ev, ok := em.PollSetEvent()
+	assert.True(t, ok)
+	assert.Equal(t, SetEvent{SetID: "dragon", Pieces: 2, Activated: true}, ev)
+	assert.Equal(t, ev, em.LastSetEvent())
+
+	em.EquipItem("armor", "boots")
+	em.EquipItem("armor", "gloves")
+	assert.Equal(t, 20.0, em.GetStat("armor"))
+	assert.Equal(t, 1.0, em.GetStat("fire"))
+	active := em.ActiveSets()
+	assert.Len(t, active, 1)
+	assert.Equal(t, 4, active[0].Equipped)
+	assert.Len(t, active[0].Bonuses, 3)
+
+	ev, _ = em.PollSetEvent()
+	assert.Equal(t, 3, ev.Pieces)
+	ev, _ = em.PollSetEvent()
+	assert.Equal(t, 4, ev.Pieces)
+
+	em.UnequipItem("armor", "helm")
+	em.UnequipItem("armor", "mail")
+	assert.Equal(t, 10.0, em.GetStat("armor"))
+	var deactivated []int
+	for {
+		ev, ok := em.PollSetEvent()
+		if !ok {
+			break
+		}
+		assert.False(t, ev.Activated)
+		deactivated = append(deactivated, ev.Pieces)
+	}
+	assert.Equal(t, []int{4, 3}, deactivated)
+}
+
+func TestEquipRules(t *testing.T) {
+	defer ResetItems()
+	metrics.Default = metrics.NewRegistry()
+	store.GetStore().SetInt("test_rules.level", 3)
+
+	assert.NoError(t, LoadItems([]byte(`[
+		{"id":"greatsword","slot_types":["weapon"],"blocks_slots":["offhand"]},
+		{"id":"dagger","slot_types":["weapon","offhand"]},
+		{"id":"shield","slot_types":["offhand"]},
+		{"id":"crown","requires":[{"store_key":"test_rules.level","min":5}]},
+		{"id":"trophy","requires":[{"metric":"bosses","min":1}]},
+		{"id":"scabbard","requires":[{"item":"dagger"}]},
+		{"id":"holy_ring","excludes":["cursed_ring"]},
+		{"id":"cursed_ring"}
+	]`)))
+
+	em := NewEquipmentManager()
+	em.DefineSlot("weapon", 1)
+	em.DefineSlot("offhand", 1)
+	em.DefineSlot("head", 1)
+	em.DefineSlot("belt", 2)
+	em.DefineSlot("ring", 2)
+
+	assert.Equal(t, EquipInvalidItem, em.Equip("weapon", ""))
+	assert.Equal(t, EquipUnknownSlot, em.Equip("feet", "dagger"))
+	assert.Equal(t, EquipWrongSlot, em.Equip("offhand", "greatsword"))
+
+	assert.Equal(t, EquipOK, em.Equip("offhand", "shield"))
+	assert.Equal(t, EquipBlocksOccupied, em.Equip("weapon", "greatsword"))
+	em.UnequipItem("offhand", "shield")
+	assert.Equal(t, EquipOK, em.Equip("weapon", "greatsword"))
+	assert.Equal(t, EquipSlotBlocked, em.CanEquip("offhand", "dagger"))
+	assert.Equal(t, EquipAlreadyEquipped, em.Equip("weapon", "greatsword"))
+
+	assert.Equal(t, EquipRequirementNotMet, em.Equip("head", "crown"))
+	assert.NoError(t, store.GetStore().SetFormula("test_rules.level", "2 + 2"))
+	assert.Equal(t, EquipRequirementNotMet, em.Equip("head", "crown"), "formulas count once")
+	store.GetStore().SetInt("test_rules.level", 5)
+	assert.Equal(t, EquipOK, em.Equip("head", "crown"))
+
+	assert.Equal(t, EquipRequirementNotMet, em.Equip("belt", "trophy"))
+	metrics.IncInt("bosses")
+	assert.Equal(t, EquipOK, em.Equip("belt", "trophy"))
+
+	assert.Equal(t, EquipRequirementNotMet, em.Equip("belt", "scabbard"))
+	em.UnequipItem("weapon", "greatsword")
+	assert.True(t, em.EquipItem("weapon", "dagger"))
+	assert.Equal(t, EquipOK, em.Equip("belt", "scabbard"))
+
+	assert.Equal(t, EquipOK, em.Equip("ring", "cursed_ring"))
+	assert.Equal(t, EquipExcluded, em.Equip("ring", "holy_ring"))
+	assert.Equal(t, EquipSlotFull, em.Equip("head", "helmet"))
+	assert.Equal(t, "slot full", EquipSlotFull.String())
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	Clear()
+	GetManager().DefineSlot("weapon", 1)
+	GetManager().EquipItem("weapon", "sword")
+
+	id := NewManagerInstance()
+	em := GetInstance(id)
+	em.DefineSlot("ring", 2)
+	em.DefineSlot("trinket", 1)
+	em.EquipItem("ring", "ruby")
+	em.EquipItem("ring", "opal")
+	em.EquipItem("trinket", "totem")
+
+	saved, err := SaveState()
+	assert.NoError(t, err)
+	data, err := json.Marshal(saved)
+	assert.NoError(t, err)
+
+	// Fresh process: nothing defined, everything comes back
+	Clear()
+	RemoveInstance(id)
+	assert.NoError(t, LoadState(data))
+	assert.Equal(t, []string{"sword"}, GetManager().GetEquippedItems("weapon"))
+	restored := GetInstance(id)
+	assert.NotNil(t, restored)
+	assert.Equal(t, []string{"ruby", "opal"}, restored.GetEquippedItems("ring"))
+	assert.Equal(t, 0, restored.GetSlotAvailability("ring"))
+	assert.NotEqual(t, id, NewManagerInstance())
+
+	// The game no longer has a trinket slot and shrank rings to one; the
+	// items that no longer fit are reported
+	RemoveInstance(id)
+	em = restoreInstance(id)
+	em.DefineSlot("ring", 1)
+	em.DefineSlot("weapon", 1)
+	err = LoadState(data)
+	assert.Equal(t, DroppedItemsError{
+		{Manager: id, SlotType: "ring", ItemID: "opal"},
+		{Manager: id, SlotType: "trinket", ItemID: "totem"},
+	}, err)
+	assert.Equal(t, []string{"ruby"}, em.GetEquippedItems("ring"))
+	assert.Empty(t, em.GetEquippedItems("weapon"))
+	assert.ElementsMatch(t, []string{"ring", "weapon"}, em.GetAllSlotTypes())
+}
+
+func TestEquipFromAndUnequipToInventory(t *testing.T) {
+	em := NewEquipmentManager()
+	em.DefineSlot("weapon", 1)
+	inv := inventory.NewInventory(2)
+	inv.AddItem(10, false, 1, 1)
+	inv.AddItem(20, false, 1, 1)
+
+	assert.Equal(t, EquipNotInInventory, em.EquipFromInventory(inv, 5, "weapon"))
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 0, "weapon"))
+	assert.Nil(t, inv.Slots[0])
+	assert.True(t, em.IsItemEquipped("weapon", "10"))
+
+	// Full slot swaps with the equipped item in place
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 1, "weapon"))
+	assert.Equal(t, []string{"20"}, em.GetEquippedItems("weapon"))
+	assert.Equal(t, 10, inv.Slots[1].ID)
+	assert.Equal(t, 1, inv.CountItem(10))
+	assert.Equal(t, 0, inv.CountItem(20))
+
+	// Bag full: unequip is refused and nothing moves
+	inv.AddItem(30, false, 1, 1)
+	assert.Equal(t, EquipNoRoom, em.UnequipToInventory("weapon", "20", inv))
+	assert.True(t, em.IsItemEquipped("weapon", "20"))
+
+	inv.RemoveItem(30, 1)
+	assert.Equal(t, EquipNotEquipped, em.UnequipToInventory("weapon", "10", inv))
+	assert.Equal(t, EquipOK, em.UnequipToInventory("weapon", "20", inv))
+	assert.True(t, em.IsSlotEmpty("weapon"))
+	assert.Equal(t, 1, inv.CountItem(20))
+}
+
+func TestEquipFromInventory_SwapNeedsRoom(t *testing.T) {
+	em := NewEquipmentManager()
+	em.DefineSlot("ammo", 1)
+	em.EquipItem("ammo", "7")
+
+	inv := inventory.NewInventory(1)
+	inv.AddItem(8, true, 10, 5)
+
+	// The stack stays in its slot, so the swapped out item has nowhere to go
+	assert.Equal(t, EquipNoRoom, em.EquipFromInventory(inv, 0, "ammo"))
+	assert.Equal(t, []string{"7"}, em.GetEquippedItems("ammo"))
+	assert.Equal(t, 5, inv.CountItem(8))
+}
+
+func TestPositionalSlots(t *testing.T) {
+	em := NewEquipmentManager()
+	em.DefineSlot("ring", 3)
+
+	assert.Equal(t, EquipOK, em.Equip("ring", "ruby"))
+	assert.Equal(t, EquipOK, em.Equip("ring", "opal"))
+	assert.Equal(t, "opal", em.GetAt("ring", 1))
+
+	// Unequipping the first ring keeps the second in place
+	assert.True(t, em.UnequipItem("ring", "ruby"))
+	assert.Equal(t, "", em.GetAt("ring", 0))
+	assert.Equal(t, "opal", em.GetAt("ring", 1))
+	assert.Equal(t, []string{"opal"}, em.GetEquippedItems("ring"))
+	assert.Equal(t, 2, em.GetSlotAvailability("ring"))
+
+	assert.Equal(t, EquipOK, em.EquipAt("ring", 2, "jade"))
+	assert.Equal(t, EquipPositionOccupied, em.EquipAt("ring", 1, "onyx"))
+	assert.Equal(t, EquipBadPosition, em.EquipAt("ring", 3, "onyx"))
+	assert.Equal(t, EquipOK, em.Equip("ring", "onyx"))
+	assert.Equal(t, "onyx", em.GetAt("ring", 0))
+
+	assert.True(t, em.SwapWithin("ring", 0, 2))
+	assert.Equal(t, []string{"jade", "opal", "onyx"}, em.GetEquippedItems("ring"))
+	assert.False(t, em.SwapWithin("ring", 0, 3))
+
+	assert.Equal(t, "opal", em.UnequipAt("ring", 1))
+	assert.Equal(t, "", em.UnequipAt("ring", 1))
+
+	evicted, ok := em.ResizeSlot("ring", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"onyx"}, evicted)
+	assert.Equal(t, []string{"jade"}, em.GetEquippedItems("ring"))
+
+	evicted, ok = em.ResizeSlot("ring", 4)
+	assert.True(t, ok)
+	assert.Empty(t, evicted)
+	_, ok = em.ResizeSlot("ring", 0)
+	assert.False(t, ok)
+}
+
+func TestDurabilityAndRepair(t *testing.T) {
+	ResetItems()
+	defer ResetItems()
+	RegisterItem(ItemDef{
+		ID:            "sword",
+		Modifiers:     []StatModifier{{Stat: "attack", Kind: Flat, Value: 5}},
+		MaxDurability: 10,
+		Repair:        []crafting.Requirement{{ID: "99", Qty: 2}},
+	})
+	RegisterItem(ItemDef{
+		ID:            "shield",
+		Modifiers:     []StatModifier{{Stat: "armor", Kind: Flat, Value: 3}},
+		MaxDurability: 4,
+		BreakUnequips: true,
+	})
+
+	em := NewEquipmentManager()
+	em.DefineSlot("hand", 2)
+	em.EquipItem("hand", "sword")
+	em.EquipItem("hand", "shield")
+	assert.Equal(t, 10.0, em.Durability("sword"))
+
+	assert.Empty(t, em.ApplyWear("hand", 3))
+	assert.Equal(t, 7.0, em.Durability("sword"))
+	assert.Equal(t, 1.0, em.Durability("shield"))
+
+	// The shield leaves its slot, the sword stays but stops counting
+	assert.Equal(t, []string{"shield"}, em.ApplyWear("hand", 1))
+	assert.False(t, em.ApplyItemWear("sword", 2))
+	assert.True(t, em.ApplyItemWear("sword", 10))
+	assert.True(t, em.IsBroken("sword"))
+	assert.Equal(t, []string{"sword"}, em.GetEquippedItems("hand"))
+	assert.Equal(t, 0.0, em.GetStat("attack"))
+	assert.Equal(t, 0.0, em.GetStat("armor"))
+	assert.False(t, em.IsBroken("shield"), "the broken shield left with its wear")
+
+	// Wear survives a save and load
+	data, err := json.Marshal(em.snapshot())
+	assert.NoError(t, err)
+	var saved savedManager
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	restored := NewEquipmentManager()
+	restored.restore(saved)
+	assert.True(t, restored.IsBroken("sword"))
+	assert.True(t, restored.IsBrokenAt("hand", 0))
+	assert.Equal(t, 0.0, restored.GetStat("attack"))
+
+	// Restoring gives the same wear whether item definitions load before or
+	// after it, and forgets stack settings of the replaced loadout
+	sword, _ := GetItem("sword")
+	shield, _ := GetItem("shield")
+	old := savedManager{
+		Slots:      map[string]savedSlot{"hand": {MaxSlots: 2, Items: []string{"sword"}}},
+		Durability: map[string]float64{"sword": 12}, // an older save
+	}
+	before := NewEquipmentManager()
+	before.restore(old)
+	ResetItems()
+	after := NewEquipmentManager()
+	after.bagItems = map[string]inventory.Item{"sword": {ID: 1}}
+	after.restore(old)
+	assert.Nil(t, after.bagItems)
+	RegisterItem(sword)
+	RegisterItem(shield)
+	assert.Equal(t, 10.0, before.Durability("sword"))
+	assert.Equal(t, 10.0, after.Durability("sword"))
+	assert.Equal(t, before.snapshot(), after.snapshot())
+
+	inv := inventory.NewInventory(2)
+	inv.AddItem(99, true, 10, 1)
+	stock := crafting.InventoryStock{Inv: inv}
+	assert.Equal(t, RepairCannotAfford, em.Repair("sword", stock))
+	assert.Equal(t, 1, inv.CountItem(99))
+
+	inv.AddItem(99, true, 10, 2)
+	assert.Equal(t, RepairOK, em.Repair("sword", stock))
+	assert.Equal(t, 1, inv.CountItem(99))
+	assert.Equal(t, 10.0, em.Durability("sword"))
+	assert.Equal(t, 5.0, em.GetStat("attack"))
+	assert.Equal(t, RepairNotNeeded, em.Repair("sword", stock))
+	assert.Equal(t, RepairNoDurability, em.Repair("ring", stock))
+
+	assert.Equal(t, RepairNotEquipped, em.RepairAt("hand", 1, stock))
+
+	// The shield comes back broken; repairs without materials are free
+	assert.Equal(t, EquipOK, em.Equip("hand", "shield"))
+	assert.True(t, em.IsBrokenAt("hand", 1))
+	assert.Equal(t, 0.0, em.GetStat("armor"))
+	assert.Equal(t, RepairOK, em.RepairAt("hand", 1, stock))
+	assert.Equal(t, 4.0, em.Durability("shield"))
+	assert.Equal(t, 3.0, em.GetStat("armor"))
+}
+
+func TestDurabilityPerEquippedCopy(t *testing.T) {
+	ResetItems()
+	defer ResetItems()
+	RegisterItem(ItemDef{ID: "ring", MaxDurability: 10, Repair: []crafting.Requirement{{ID: "99", Qty: 1}, {ID: "99", Qty: 1}}})
+
+	em := NewEquipmentManager()
+	em.DefineSlot("left", 1)
+	em.DefineSlot("right", 2)
+	em.EquipItem("left", "ring")
+	em.EquipAt("right", 1, "ring")
+
+	assert.False(t, em.ApplyWearAt("right", 1, 6))
+	assert.Equal(t, 10.0, em.DurabilityAt("left", 0))
+	assert.Equal(t, 4.0, em.DurabilityAt("right", 1))
+
+	// Wear moves with the item inside its slot and leaves with it
+	assert.True(t, em.SwapWithin("right", 0, 1))
+	assert.Equal(t, 4.0, em.DurabilityAt("right", 0))
+	assert.Equal(t, "ring", em.UnequipAt("right", 0))
+	assert.Equal(t, EquipOK, em.EquipAt("right", 1, "ring"))
+	assert.Equal(t, 4.0, em.DurabilityAt("right", 1))
+	assert.True(t, em.SwapWithin("right", 0, 1))
+
+	// Duplicate repair requirements are paid in full or not at all
+	assert.False(t, em.ApplyWearAt("left", 0, 1))
+	inv := inventory.NewInventory(2)
+	inv.AddItem(99, true, 10, 1)
+	stock := crafting.InventoryStock{Inv: inv}
+	assert.Equal(t, RepairCannotAfford, em.RepairAt("left", 0, stock))
+	assert.Equal(t, 1, inv.CountItem(99))
+	inv.AddItem(99, true, 10, 1)
+	assert.Equal(t, RepairOK, em.Repair("ring", stock))
+	assert.Equal(t, 0, inv.CountItem(99))
+
+	// Wear is saved per copy
+	em.ApplyWearAt("right", 0, 3)
+	data, err := json.Marshal(em.snapshot())
+	assert.NoError(t, err)
+	var saved savedManager
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	restored := NewEquipmentManager()
+	restored.restore(saved)
+	assert.Equal(t, 10.0, restored.DurabilityAt("left", 0))
+	assert.Equal(t, 1.0, restored.DurabilityAt("right", 0))
+}
+
+func TestEvictedItemsKeepWear(t *testing.T) {
+	ResetItems()
+	defer ResetItems()
+	for _, id := range []string{"7", "8", "9"} {
+		RegisterItem(ItemDef{ID: id, MaxDurability: 10})
+	}
+
+	em := NewEquipmentManager()
+	em.DefineSlot("ring", 2)
+	em.DefineSlot("neck", 1)
+	inv := inventory.NewInventory(4)
+	inv.AddItem(7, true, 20, 1)
+	inv.AddItem(8, true, 20, 1)
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 0, "ring"))
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 1, "ring"))
+	assert.True(t, em.EquipItem("neck", "9"))
+	em.ApplyWear("ring", 4)
+	em.ApplyWear("neck", 4)
+
+	evicted, _ := em.ResizeSlot("ring", 1)
+	assert.Equal(t, []string{"8"}, evicted)
+	assert.True(t, em.RemoveSlotDefinition("neck"))
+
+	em.DefineSlot("ring", 2)
+	em.DefineSlot("neck", 1)
+	assert.True(t, em.EquipItem("ring", "8"))
+	assert.True(t, em.EquipItem("neck", "9"))
+	assert.Equal(t, 6.0, em.Durability("8"))
+	assert.Equal(t, 6.0, em.Durability("9"))
+	_, ok := em.bagItems["8"]
+	assert.False(t, ok, "stack settings of the evicted item are gone")
+	assert.Equal(t, 6.0, em.Durability("7"), "items that stayed keep their wear")
+}
+
+func TestWearSurvivesUnequip(t *testing.T) {
+	ResetItems()
+	defer ResetItems()
+	RegisterItem(ItemDef{ID: "5", MaxDurability: 10, Repair: []crafting.Requirement{{ID: "99", Qty: 1}}})
+
+	em := NewEquipmentManager()
+	em.DefineSlot("hand", 1)
+	inv := inventory.NewInventory(4)
+	inv.AddItem(5, true, 20, 2)
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 0, "hand"))
+	assert.Empty(t, em.ApplyWear("hand", 9))
+	assert.Equal(t, 1.0, em.Durability("5"))
+
+	// Going through the inventory doesn't repair the item
+	assert.Equal(t, EquipOK, em.UnequipToInventory("hand", "5", inv))
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 0, "hand"))
+	assert.Equal(t, 1.0, em.Durability("5"))
+
+	// Neither does a save and load while it is in the inventory
+	assert.Equal(t, EquipOK, em.UnequipToInventory("hand", "5", inv))
+	data, err := json.Marshal(em.snapshot())
+	assert.NoError(t, err)
+	var saved savedManager
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	restored := NewEquipmentManager()
+	restored.restore(saved)
+	assert.True(t, restored.EquipItem("hand", "5"))
+	assert.Equal(t, 1.0, restored.Durability("5"))
+
+	// Only a repair does
+	inv.AddItem(99, true, 10, 1)
+	assert.Equal(t, RepairOK, restored.Repair("5", crafting.InventoryStock{Inv: inv}))
+	assert.Equal(t, EquipOK, restored.UnequipToInventory("hand", "5", inv))
+	assert.True(t, restored.EquipItem("hand", "5"))
+	assert.Equal(t, 10.0, restored.Durability("5"))
+}
+
+func TestLoadItemsRevalidatesRecipes(t *testing.T) {
+	crafting.ResetAll()
+	defer crafting.ResetAll()
+	defer crafting.ResetKnownItems()
+	defer ResetItems()
+	crafting.SetStrict(true)
+	defer crafting.SetStrict(false)
+	crafting.AddKnownItems("99")
+	ResetItems()
+
+	assert.Error(t, crafting.LoadManagers(json.RawMessage(`{"smithy": [{"id":"blade","requirements":[{"id":"ore","qty":1}]}]}`)))
+	_, ok := crafting.Get("smithy")
+	assert.False(t, ok)
+
+	assert.NoError(t, LoadItems([]byte(`[{"id":"ore"}]`)))
+	_, ok = crafting.Get("smithy")
+	assert.True(t, ok)
+}
+
+func TestStackSettingsSurviveLoad(t *testing.T) {
+	em := NewEquipmentManager()
+	em.DefineSlot("quiver", 1)
+	inv := inventory.NewInventory(3)
+	inv.AddItem(12, true, 50, 10)
+	assert.Equal(t, EquipOK, em.EquipFromInventory(inv, 0, "quiver"))
+
+	data, err := json.Marshal(em.snapshot())
+	assert.NoError(t, err)
+	var saved savedManager
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	restored := NewEquipmentManager()
+	assert.Empty(t, restored.restore(saved))
+
+	// The arrow goes back onto its stack instead of a slot of its own
+	assert.Equal(t, EquipOK, restored.UnequipToInventory("quiver", "12", inv))
+	assert.Equal(t, 10, inv.Slots[0].Quantity)
+	assert.Nil(t, inv.Slots[1])
+
+	// Stack settings of items that didn't come back are dropped
+	saved.Slots = nil
+	restored.restore(saved)
+	assert.Nil(t, restored.bagItems)
+}
@@ -0,0 +1,133 @@
+package equipment
+
+import (
+	"codex/pkg/inventory"
+	"strconv"
+)
+
+// Equipment item IDs are the decimal form of inventory item IDs
+
+// EquipFromInventory moves one item from an inventory slot into slotType.
+// When slotType is full the item in its first position is swapped back into
+// the inventory.
+// Nothing changes unless the whole move succeeds.
+func (em *EquipmentManager) EquipFromInventory(inv *inventory.Inventory, slotIdx int, slotType string) EquipResult {
+	if inv == nil || slotIdx < 0 || slotIdx >= len(inv.Slots) {
+		return EquipNotInInventory
+	}
+	bagItem := inv.Slots[slotIdx]
+	if bagItem == nil || bagItem.Quantity == 0 {
+		return EquipNotInInventory
+	}
+	itemID := strconv.Itoa(bagItem.ID)
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	res := em.checkEquip(slotType, itemID)
+	if res != EquipSlotFull {
+		if res != EquipOK {
+			return res
+		}
+		inv.RemoveFromSlot(slotIdx, 1)
+		slot := em.slots[slotType]
+		em.finishEquip(slot, slot.freeIndex(), itemID, *bagItem)
+		return EquipOK
+	}
+
+	// Swap with the item in the first position
+	slot := em.slots[slotType]
+	pos := 0
+	for slot.at(pos) == "" {
+		pos++
+	}
+	old := slot.at(pos)
+	oldID, err := strconv.Atoi(old)
+	if err != nil {
+		return EquipInvalidItem
+	}
+	slot.ItemIDS[pos] = ""
+	if res := em.checkEquip(slotType, itemID); res != EquipOK {
+		slot.ItemIDS[pos] = old
+		return res
+	}
+
+	oldBag := em.bagItem(old, oldID)
+	freesSlot := bagItem.Quantity == 1
+	if !freesSlot && inv.RemainingCapacity(oldID, oldBag.Stackable, oldBag.MaxStackSize) < 1 {
+		slot.ItemIDS[pos] = old
+		return EquipNoRoom
+	}
+
+	taken := *bagItem
+	inv.RemoveFromSlot(slotIdx, 1)
+	if freesSlot {
+		inv.PlaceInSlot(slotIdx, oldBag)
+	} else {
+		inv.AddItem(oldID, oldBag.Stackable, oldBag.MaxStackSize, 1)
+	}
+	slot.ItemIDS[pos] = old
+	em.removeLocked(slot, pos)
+	delete(em.bagItems, old)
+	em.finishEquip(slot, pos, itemID, taken)
+	return EquipOK
+}
+
+// UnequipToInventory moves an equipped item into inv, refusing when inv has
+// no room for it
+func (em *EquipmentManager) UnequipToInventory(slotType string, itemID string, inv *inventory.Inventory) EquipResult {
+	if inv == nil {
+		return EquipNoRoom
+	}
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		return EquipInvalidItem
+	}
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	slot, exists := em.slots[slotType]
+	if !exists {
+		return EquipUnknownSlot
+	}
+	pos := slot.indexOf(itemID)
+	if pos < 0 {
+		return EquipNotEquipped
+	}
+
+	bag := em.bagItem(itemID, id)
+	if inv.RemainingCapacity(id, bag.Stackable, bag.MaxStackSize) < 1 {
+		return EquipNoRoom
+	}
+	inv.AddItem(id, bag.Stackable, bag.MaxStackSize, 1)
+
+	em.removeLocked(slot, pos)
+	delete(em.bagItems, itemID)
+	em.recalcStats()
+	return EquipOK
+}
+
+// finishEquip places an item taken from an inventory; em.mu must be held
+func (em *EquipmentManager) finishEquip(slot *SlotConfig, pos int, itemID string, from inventory.Item) {
+	em.placeLocked(slot, pos, itemID)
+	if em.bagItems == nil {
+		em.bagItems = make(map[string]inventory.Item)
+	}
+	em.bagItems[itemID] = inventory.Item{
+		ID:           from.ID,
+		Quantity:     1,
+		Stackable:    from.Stackable,
+		MaxStackSize: from.MaxStackSize,
+	}
+	em.recalcStats()
+}
+
+// bagItem returns a single inventory item for an equipped ID. Items that
+// weren't equipped from an inventory are treated as unstackable.
+func (em *EquipmentManager) bagItem(itemID string, id int) inventory.Item {
+	if item, ok := em.bagItems[itemID]; ok {
+		return item
+	}
+	return inventory.Item{ID: id, Quantity: 1, MaxStackSize: 1}
+}
@@ -0,0 +1,228 @@
+package equipment
+
+import (
+	"codex/pkg/inventory"
+	"codex/pkg/storage"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type savedSlot struct {
+	MaxSlots int             `json:"max_slots"`
+	Items    []string        `json:"items"`          // by position, "" for empty positions
+	Wear     map[int]float64 `json:"wear,omitempty"` // position -> durability of worn items
+}
+
+type savedManager struct {
+	Slots map[string]savedSlot `json:"slots"`
+	// Durability is how older saves kept wear, by item ID; it is applied to
+	// every equipped copy
+	Durability map[string]float64      `json:"durability,omitempty"`
+	Worn       map[string][]float64    `json:"worn,omitempty"`      // item ID -> wear of unequipped copies
+	BagItems   map[string]savedBagItem `json:"bag_items,omitempty"` // item ID -> stack settings
+}
+
+// savedBagItem is how an item equipped from an inventory goes back to one
+type savedBagItem struct {
+	ID           int  `json:"id"`
+	Stackable    bool `json:"stackable"`
+	MaxStackSize int  `json:"max_stack_size"`
+}
+
+type savedState struct {
+	Managers map[int]savedManager `json:"managers"` // manager ID -> loadout, 0 is the global manager
+}
+
+// DroppedItem is a saved item LoadState could not put back, because its
+// slot type is no longer defined or its position no longer fits
+type DroppedItem struct {
+	Manager  int
+	SlotType string
+	ItemID   string
+}
+
+// DroppedItemsError lists every item dropped by a LoadState call
+type DroppedItemsError []DroppedItem
+
+func (errs DroppedItemsError) Error() string {
+	msgs := make([]string, len(errs))
+	for i, d := range errs {
+		msgs[i] = fmt.Sprintf("%d/%s/%s", d.Manager, d.SlotType, d.ItemID)
+	}
+	return "equipment: dropped saved items " + strings.Join(msgs, ", ")
+}
+
+func init() {
+	storage.SM().BindFuncs("equipment", LoadState, SaveState)
+}
+
+// SaveState returns slot definitions, equipped items and item wear of every manager
+func SaveState() (any, error) {
+	state := savedState{Managers: make(map[int]savedManager)}
+	state.Managers[0] = GetManager().snapshot()
+
+	instancesMu.RLock()
+	defer instancesMu.RUnlock()
+	for id, em := range instances {
+		state.Managers[id] = em.snapshot()
+	}
+	return state, nil
+}
+
+// LoadState restores slot definitions and equipped items, recreating managers
+// that no longer exist under their saved IDs. Managers that already define
+// slots keep their definitions: saved slot types they don't define are treated
+// as removed from the game, and their items, like items in positions past
+// a shrunken slot, are dropped. Everything else is still restored when items
+// are dropped; they are returned as a DroppedItemsError.
+func LoadState(data json.RawMessage) error {
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to unmarshal equipment: %w", err)
+	}
+
+	ids := make([]int, 0, len(state.Managers))
+	for id := range state.Managers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var dropped DroppedItemsError
+	for _, id := range ids {
+		if id < 0 {
+			continue
+		}
+		em := GetInstance(id)
+		if em == nil {
+			em = restoreInstance(id)
+		}
+		dropped = append(dropped, em.restore(state.Managers[id])...)
+	}
+	if len(dropped) > 0 {
+		return dropped
+	}
+	return nil
+}
+
+// restoreInstance creates a manager under a specific ID
+func restoreInstance(id int) *EquipmentManager {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	em := NewEquipmentManager()
+	em.ID = id
+	instances[id] = em
+	if id >= nextID {
+		nextID = id + 1
+	}
+	return em
+}
+
+func (em *EquipmentManager) snapshot() savedManager {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	saved := savedManager{Slots: make(map[string]savedSlot, len(em.slots))}
+	for slotType, slot := range em.slots {
+		c := slot.clone()
+		saved.Slots[slotType] = savedSlot{
+			MaxSlots: c.MaxSlots,
+			Items:    c.ItemIDS,
+			Wear:     c.wear,
+		}
+	}
+	for id, ds := range em.worn {
+		if saved.Worn == nil {
+			saved.Worn = make(map[string][]float64, len(em.worn))
+		}
+		saved.Worn[id] = append([]float64(nil), ds...)
+	}
+	for id, item := range em.bagItems {
+		if saved.BagItems == nil {
+			saved.BagItems = make(map[string]savedBagItem, len(em.bagItems))
+		}
+		saved.BagItems[id] = savedBagItem{ID: item.ID, Stackable: item.Stackable, MaxStackSize: item.MaxStackSize}
+	}
+	return saved
+}
+
+// restore replaces the loadout with saved and returns the items that could
+// not be put back. Saved wear is kept as is, whatever the item definitions
+// loaded so far say; it is capped at the current maximum when read. Stack
+// settings come back for the items that are equipped again.
+func (em *EquipmentManager) restore(saved savedManager) []DroppedItem {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	defined := len(em.slots) > 0
+	for _, slot := range em.slots {
+		slot.ItemIDS = slot.ItemIDS[:0]
+	}
+
+	slotTypes := make([]string, 0, len(saved.Slots))
+	for slotType := range saved.Slots {
+		slotTypes = append(slotTypes, slotType)
+	}
+	sort.Strings(slotTypes)
+
+	var dropped []DroppedItem
+	for _, slotType := range slotTypes {
+		ss := saved.Slots[slotType]
+		slot, exists := em.slots[slotType]
+		if !exists && !defined && ss.MaxSlots >= 1 {
+			slot = &SlotConfig{ItemIDS: make([]string, 0), MaxSlots: ss.MaxSlots}
+			em.slots[slotType] = slot
+		}
+		for i, id := range ss.Items {
+			if id == "" {
+				continue
+			}
+			if slot == nil || i >= slot.MaxSlots || slot.indexOf(id) >= 0 {
+				dropped = append(dropped, DroppedItem{Manager: em.ID, SlotType: slotType, ItemID: id})
+				continue
+			}
+			slot.place(i, id)
+			if d, worn := ss.Wear[i]; worn {
+				slot.setWear(i, d)
+			} else if d, worn := saved.Durability[id]; worn {
+				slot.setWear(i, d)
+			}
+		}
+	}
+	em.bagItems = nil
+	for id, item := range saved.BagItems {
+		if em.equippedAnywhereLocked(id) {
+			if em.bagItems == nil {
+				em.bagItems = make(map[string]inventory.Item, len(saved.BagItems))
+			}
+			em.bagItems[id] = inventory.Item{ID: item.ID, Quantity: 1, Stackable: item.Stackable, MaxStackSize: item.MaxStackSize}
+		}
+	}
+	em.worn = nil
+	for id, ds := range saved.Worn {
+		if len(ds) == 0 {
+			continue
+		}
+		if em.worn == nil {
+			em.worn = make(map[string][]float64, len(saved.Worn))
+		}
+		em.worn[id] = append([]float64(nil), ds...)
+	}
+
+	em.recalcStats()
+	// Restoring isn't a change the UI should announce
+	em.setEvents = nil
+	return dropped
+}
+
+// equippedAnywhereLocked reports whether any slot holds itemID; em.mu must
+// be held
+func (em *EquipmentManager) equippedAnywhereLocked(itemID string) bool {
+	for _, slot := range em.slots {
+		if slot.indexOf(itemID) >= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package equipment
+
+import (
+	"codex/pkg/metrics"
+	"codex/pkg/store"
+)
+
+// EquipResult is the reason code returned by Equip and CanEquip
+type EquipResult int
+
+const (
+	EquipOK EquipResult = iota
+	EquipInvalidItem
+	EquipUnknownSlot
+	EquipAlreadyEquipped
+	EquipWrongSlot
+	EquipExcluded
+	EquipSlotBlocked    // another equipped item blocks the slot
+	EquipBlocksOccupied // the item would block a slot that holds items
+	EquipRequirementNotMet
+	EquipSlotFull
+	EquipNotInInventory // the inventory slot is empty or out of range
+	EquipNoRoom         // the inventory can't take the item back
+	EquipNotEquipped
+	EquipBadPosition      // the position is outside the slot
+	EquipPositionOccupied // the position already holds an item
+)
+
+func (r EquipResult) String() string {
+	switch r {
+	case EquipOK:
+		return "ok"
+	case EquipInvalidItem:
+		return "invalid item"
+	case EquipUnknownSlot:
+		return "unknown slot"
+	case EquipAlreadyEquipped:
+		return "already equipped"
+	case EquipWrongSlot:
+		return "wrong slot"
+	case EquipExcluded:
+		return "excluded by equipped item"
+	case EquipSlotBlocked:
+		return "slot blocked"
+	case EquipBlocksOccupied:
+		return "would block occupied slot"
+	case EquipRequirementNotMet:
+		return "requirement not met"
+	case EquipSlotFull:
+		return "slot full"
+	case EquipNotInInventory:
+		return "not in inventory"
+	case EquipNoRoom:
+		return "no room in inventory"
+	case EquipNotEquipped:
+		return "not equipped"
+	case EquipBadPosition:
+		return "bad position"
+	case EquipPositionOccupied:
+		return "position occupied"
+	}
+	return "unknown result"
+}
+
+// EquipRequirement is a condition that must hold to equip an item. Set one
+// of StoreKey or Metric with a Min value, or Item to require another
+// equipped item.
+type EquipRequirement struct {
+	StoreKey string  `json:"store_key,omitempty"`
+	Metric   string  `json:"metric,omitempty"`
+	Min      float64 `json:"min,omitempty"`
+	Item     string  `json:"item,omitempty"`
+}
+
+// CanEquip reports whether an item could be equipped without changing anything
+func (em *EquipmentManager) CanEquip(slotType string, itemID string) EquipResult {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return em.checkEquip(slotType, itemID)
+}
+
+// checkEquip evaluates every equip rule; em.mu must be held
+func (em *EquipmentManager) checkEquip(slotType string, itemID string) EquipResult {
+	if itemID == "" {
+		return EquipInvalidItem
+	}
+
+	slot, exists := em.slots[slotType]
+	if !exists {
+		return EquipUnknownSlot
+	}
+
+	if slot.indexOf(itemID) >= 0 {
+		return EquipAlreadyEquipped
+	}
+
+	def, _ := GetItem(itemID)
+	if len(def.SlotTypes) > 0 && !contains(def.SlotTypes, slotType) {
+		return EquipWrongSlot
+	}
+
+	equipped := em.equippedLocked()
+	for _, other := range equipped {
+		otherDef, _ := GetItem(other)
+		if contains(def.Excludes, other) || contains(otherDef.Excludes, itemID) {
+			return EquipExcluded
+		}
+		if contains(otherDef.BlocksSlots, slotType) {
+			return EquipSlotBlocked
+		}
+	}
+
+	for _, blocked := range def.BlocksSlots {
+		if s, ok := em.slots[blocked]; ok && s.count() > 0 {
+			return EquipBlocksOccupied
+		}
+	}
+
+	for _, req := range def.Requires {
+		if !req.met(equipped) {
+			return EquipRequirementNotMet
+		}
+	}
+
+	if slot.count() >= slot.MaxSlots {
+		return EquipSlotFull
+	}
+	return EquipOK
+}
+
+func (req EquipRequirement) met(equipped []string) bool {
+	if req.Item != "" && !contains(equipped, req.Item) {
+		return false
+	}
+	if req.StoreKey != "" {
+		if value, _ := store.GetStore().GetNumber(req.StoreKey); value < req.Min {
+			return false
+		}
+	}
+	if req.Metric != "" && float64(metrics.GetInt(req.Metric)) < req.Min {
+		return false
+	}
+	return true
+}
+
+// equippedLocked returns every equipped item; em.mu must be held
+func (em *EquipmentManager) equippedLocked() []string {
+	var result []string
+	for _, slot := range em.slots {
+		result = append(result, slot.items()...)
+	}
+	return result
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
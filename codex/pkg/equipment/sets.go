@@ -0,0 +1,203 @@
+package equipment
+
+import (
+	"codex/pkg/storage"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SetBonus grants modifiers once Pieces items of its set are equipped
+type SetBonus struct {
+	Pieces    int            `json:"pieces"`
+	Modifiers []StatModifier `json:"modifiers"`
+}
+
+// SetDef groups items that grant bonuses when equipped together
+type SetDef struct {
+	ID      string     `json:"id"`
+	Items   []string   `json:"items"`
+	Bonuses []SetBonus `json:"bonuses"`
+}
+
+// SetEvent reports a set bonus tier turning on or off
+type SetEvent struct {
+	SetID     string
+	Pieces    int // tier threshold that changed
+	Activated bool
+}
+
+// ActiveSet is a set with at least one active bonus
+type ActiveSet struct {
+	SetID    string
+	Equipped int
+	Bonuses  []SetBonus
+}
+
+const maxSetEvents = 64
+
+var sets = make(map[string]SetDef)
+
+func init() {
+	storage.SM().BindFuncs("equipment_sets", LoadSets, nil)
+}
+
+// LoadSets replaces all set definitions with the given JSON list
+func LoadSets(data json.RawMessage) error {
+	var defs []SetDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("failed to unmarshal equipment sets: %w", err)
+	}
+
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	sets = make(map[string]SetDef, len(defs))
+	for _, def := range defs {
+		sets[def.ID] = normalizeSet(def)
+	}
+	itemsVersion++
+	return nil
+}
+
+// RegisterSet adds or replaces a single set definition
+func RegisterSet(def SetDef) {
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	sets[def.ID] = normalizeSet(def)
+	itemsVersion++
+}
+
+// ResetSets removes all set definitions
+func ResetSets() {
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	sets = make(map[string]SetDef)
+	itemsVersion++
+}
+
+func normalizeSet(def SetDef) SetDef {
+	bonuses := append([]SetBonus(nil), def.Bonuses...)
+	sort.SliceStable(bonuses, func(i, j int) bool { return bonuses[i].Pieces < bonuses[j].Pieces })
+	def.Bonuses = bonuses
+	return def
+}
+
+// countSetPieces returns how many distinct items of each set are equipped;
+// itemsMu must be held
+func countSetPieces(equipped map[string]struct{}) map[string]int {
+	counts := make(map[string]int)
+	for id, def := range sets {
+		n := 0
+		for _, item := range def.Items {
+			if _, ok := equipped[item]; ok {
+				n++
+			}
+		}
+		if n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts
+}
+
+// setModifiers returns the modifiers of every active set bonus; itemsMu must be held
+func setModifiers(counts map[string]int) []StatModifier {
+	var modifiers []StatModifier
+	for id, n := range counts {
+		for _, bonus := range sets[id].Bonuses {
+			if bonus.Pieces <= n {
+				modifiers = append(modifiers, bonus.Modifiers...)
+			}
+		}
+	}
+	return modifiers
+}
+
+// queueSetEvents records tier changes between two piece counts; itemsMu and
+// em.mu must be held
+func (em *EquipmentManager) queueSetEvents(before, after map[string]int) {
+	ids := make([]string, 0, len(sets))
+	for id := range sets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		old, cur := before[id], after[id]
+		if old == cur {
+			continue
+		}
+		for _, bonus := range sets[id].Bonuses {
+			was, is := old >= bonus.Pieces, cur >= bonus.Pieces
+			if was == is {
+				continue
+			}
+			em.setEvents = append(em.setEvents, SetEvent{SetID: id, Pieces: bonus.Pieces, Activated: is})
+		}
+	}
+	if over := len(em.setEvents) - maxSetEvents; over > 0 {
+		em.setEvents = em.setEvents[over:]
+	}
+}
+
+// PollSetEvent pops the oldest pending set bonus change
+func (em *EquipmentManager) PollSetEvent() (SetEvent, bool) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	if len(em.setEvents) == 0 {
+		return SetEvent{}, false
+	}
+	ev := em.setEvents[0]
+	em.setEvents = em.setEvents[1:]
+	em.lastSetEvent = ev
+	return ev, true
+}
+
+// LastSetEvent returns the event most recently returned by PollSetEvent
+func (em *EquipmentManager) LastSetEvent() SetEvent {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return em.lastSetEvent
+}
+
+// ActiveSetIDs returns the IDs of the sets returned by ActiveSets
+func (em *EquipmentManager) ActiveSetIDs() []string {
+	active := em.ActiveSets()
+	ids := make([]string, len(active))
+	for i, a := range active {
+		ids[i] = a.SetID
+	}
+	return ids
+}
+
+// SetPieces returns how many items of a set are equipped
+func (em *EquipmentManager) SetPieces(setID string) int {
+	em.Stats() // make sure counts reflect the current definitions
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return em.setPieces[setID]
+}
+
+// ActiveSets returns every set with at least one active bonus, sorted by ID
+func (em *EquipmentManager) ActiveSets() []ActiveSet {
+	em.Stats()
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	itemsMu.RLock()
+	defer itemsMu.RUnlock()
+
+	var result []ActiveSet
+	for id, n := range em.setPieces {
+		active := ActiveSet{SetID: id, Equipped: n}
+		for _, bonus := range sets[id].Bonuses {
+			if bonus.Pieces <= n {
+				active.Bonuses = append(active.Bonuses, bonus)
+			}
+		}
+		if len(active.Bonuses) > 0 {
+			result = append(result, active)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SetID < result[j].SetID })
+	return result
+}
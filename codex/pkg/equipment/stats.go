@@ -0,0 +1,215 @@
+package equipment
+
+import (
+	"codex/pkg/crafting"
+	"codex/pkg/storage"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ModifierKind selects how a stat modifier is combined
+type ModifierKind string
+
+const (
+	Flat       ModifierKind = "flat"        // added to the base value
+	PercentAdd ModifierKind = "percent_add" // summed, then applied once as (1 + sum)
+	Multiplier ModifierKind = "mult"        // each multiplies the result
+)
+
+// StatModifier changes a single stat while its item is equipped
+type StatModifier struct {
+	Stat  string       `json:"stat"`
+	Kind  ModifierKind `json:"kind"`
+	Value float64      `json:"value"`
+}
+
+// ItemDef describes an equippable item and the rules for equipping it
+type ItemDef struct {
+	ID          string             `json:"id"`
+	Modifiers   []StatModifier     `json:"modifiers"`
+	SlotTypes   []string           `json:"slot_types,omitempty"`   // empty allows any slot
+	Requires    []EquipRequirement `json:"requires,omitempty"`     // all must hold to equip
+	BlocksSlots []string           `json:"blocks_slots,omitempty"` // slot types that must stay empty while equipped
+	Excludes    []string           `json:"excludes,omitempty"`     // items that can't be equipped alongside
+
+	MaxDurability float64                `json:"max_durability,omitempty"` // 0 means the item never wears
+	BreakUnequips bool                   `json:"break_unequips,omitempty"` // broken items leave their slot
+	Repair        []crafting.Requirement `json:"repair,omitempty"`         // materials consumed by a repair
+}
+
+// itemsMu guards item and set definitions; itemsVersion changes with either
+var (
+	itemsMu      sync.RWMutex
+	items        = make(map[string]ItemDef)
+	itemsVersion = 1
+)
+
+func init() {
+	storage.SM().BindFuncs("equipment_items", LoadItems, nil)
+	crafting.SetItemSource(ItemIDs)
+}
+
+// LoadItems replaces all item definitions with the given JSON list. Recipes
+// loaded before them are validated again against the new items; their
+// problems are returned after the items are in place.
+func LoadItems(data json.RawMessage) error {
+	var defs []ItemDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("failed to unmarshal equipment items: %w", err)
+	}
+
+	itemsMu.Lock()
+	items = make(map[string]ItemDef, len(defs))
+	for _, def := range defs {
+		items[def.ID] = def
+	}
+	itemsVersion++
+	itemsMu.Unlock()
+
+	return crafting.Revalidate()
+}
+
+// RegisterItem adds or replaces a single item definition
+func RegisterItem(def ItemDef) {
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	items[def.ID] = def
+	itemsVersion++
+}
+
+// GetItem returns the definition of an item
+func GetItem(id string) (ItemDef, bool) {
+	itemsMu.RLock()
+	defer itemsMu.RUnlock()
+	def, ok := items[id]
+	return def, ok
+}
+
+// ItemIDs returns the IDs of every defined item, sorted
+func ItemIDs() []string {
+	itemsMu.RLock()
+	defer itemsMu.RUnlock()
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ResetItems removes all item definitions
+func ResetItems() {
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	items = make(map[string]ItemDef)
+	itemsVersion++
+}
+
+type statTotals struct {
+	flat    float64
+	percent float64
+	mult    float64
+}
+
+// aggregateStats combines base stats with item and set bonus modifiers as
+// (base + flat) * (1 + percent) * mult
+func aggregateStats(base map[string]float64, modifiers []StatModifier) map[string]float64 {
+	totals := make(map[string]*statTotals)
+	get := func(stat string) *statTotals {
+		t, ok := totals[stat]
+		if !ok {
+			t = &statTotals{mult: 1}
+			totals[stat] = t
+		}
+		return t
+	}
+
+	for stat, v := range base {
+		get(stat).flat += v
+	}
+	for _, mod := range modifiers {
+		t := get(mod.Stat)
+		switch mod.Kind {
+		case Flat:
+			t.flat += mod.Value
+		case PercentAdd:
+			t.percent += mod.Value
+		case Multiplier:
+			t.mult *= mod.Value
+		}
+	}
+
+	out := make(map[string]float64, len(totals))
+	for stat, t := range totals {
+		out[stat] = t.flat * (1 + t.percent) * t.mult
+	}
+	return out
+}
+
+// recalcStats rebuilds the cached stat totals; em.mu must be held for writing.
+// Broken items contribute neither modifiers nor set pieces.
+func (em *EquipmentManager) recalcStats() {
+	itemsMu.RLock()
+	var modifiers []StatModifier
+	equipped := make(map[string]struct{})
+	for _, slot := range em.slots {
+		for i, id := range slot.ItemIDS {
+			if id == "" || slot.broken(i) {
+				continue
+			}
+			modifiers = append(modifiers, items[id].Modifiers...)
+			equipped[id] = struct{}{}
+		}
+	}
+	pieces := countSetPieces(equipped)
+	modifiers = append(modifiers, setModifiers(pieces)...)
+	em.queueSetEvents(em.setPieces, pieces)
+	version := itemsVersion
+	itemsMu.RUnlock()
+
+	em.setPieces = pieces
+
+	em.stats = aggregateStats(em.baseStats, modifiers)
+	em.statsVersion = version
+}
+
+// SetBaseStat sets the value a stat has before equipment modifiers
+func (em *EquipmentManager) SetBaseStat(stat string, value float64) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	if em.baseStats == nil {
+		em.baseStats = make(map[string]float64)
+	}
+	em.baseStats[stat] = value
+	em.recalcStats()
+}
+
+// GetStat returns the aggregated value of a stat
+func (em *EquipmentManager) GetStat(stat string) float64 {
+	return em.Stats()[stat]
+}
+
+// Stats returns a copy of every aggregated stat
+func (em *EquipmentManager) Stats() map[string]float64 {
+	itemsMu.RLock()
+	version := itemsVersion
+	itemsMu.RUnlock()
+
+	em.mu.RLock()
+	if em.statsVersion != version {
+		em.mu.RUnlock()
+		em.mu.Lock()
+		em.recalcStats()
+		em.mu.Unlock()
+		em.mu.RLock()
+	}
+	defer em.mu.RUnlock()
+
+	out := make(map[string]float64, len(em.stats))
+	for stat, v := range em.stats {
+		out[stat] = v
+	}
+	return out
+}
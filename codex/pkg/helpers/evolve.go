@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"codex/pkg/crafting"
+	"codex/pkg/equipment"
+)
+
+// An upgrade is an evolution of the items it requires. Every requirement
+// with an ID must be equipped at its minimum level; those without Keep are
+// consumed when the evolution is picked. Requirements with an empty ID mark
+// base items that only need a free slot.
+
+// position is where an equipped item sits
+type position struct {
+	slotType string
+	index    int
+}
+
+// findEquipped returns the position of an equipped item
+func findEquipped(em *equipment.EquipmentManager, itemID string) (position, bool) {
+	for _, slotType := range em.GetAllSlotTypes() {
+		if !em.IsItemEquipped(slotType, itemID) {
+			continue
+		}
+		size := len(em.GetEquippedItems(slotType)) + em.GetSlotAvailability(slotType)
+		for i := 0; i < size; i++ {
+			if em.GetAt(slotType, i) == itemID {
+				return position{slotType: slotType, index: i}, true
+			}
+		}
+	}
+	return position{}, false
+}
+
+// prerequisites returns the requirements of c that name an item
+func prerequisites(c crafting.Craftable) []crafting.Requirement {
+	var reqs []crafting.Requirement
+	for _, req := range c.Requirements {
+		if req.ID != "" {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// evolutionReady reports whether every prerequisite of c is equipped at its
+// minimum level and the result's slot type has room once consumed items leave
+func (s *UpgradeSystem) evolutionReady(em *equipment.EquipmentManager, c crafting.Craftable) bool {
+	reqs := prerequisites(c)
+	slotType := s.slotTypeOf(c.ID)
+	if len(reqs) == 0 || !hasSlotType(em, slotType) {
+		return false
+	}
+
+	freed := 0
+	for _, req := range reqs {
+		pos, ok := findEquipped(em, req.ID)
+		if !ok || s.ItemLevel(req.ID) < req.Level {
+			return false
+		}
+		if !req.Keep && pos.slotType == slotType {
+			freed++
+		}
+	}
+
+	return em.GetSlotAvailability(slotType)+freed > 0
+}
+
+// evolve consumes the prerequisites of c and equips c in their place,
+// restoring everything if the result can't be equipped
+func (s *UpgradeSystem) evolve(em *equipment.EquipmentManager, c crafting.Craftable) bool {
+	if !s.evolutionReady(em, c) {
+		return false
+	}
+
+	type removed struct {
+		itemID string
+		pos    position
+	}
+	var consumed []removed
+	for _, req := range prerequisites(c) {
+		if req.Keep {
+			continue
+		}
+		pos, _ := findEquipped(em, req.ID)
+		if em.UnequipAt(pos.slotType, pos.index) == "" {
+			continue
+		}
+		consumed = append(consumed, removed{itemID: req.ID, pos: pos})
+	}
+
+	if em.EquipItem(s.slotTypeOf(c.ID), c.ID) {
+		return true
+	}
+	for i := len(consumed) - 1; i >= 0; i-- {
+		em.EquipAt(consumed[i].pos.slotType, consumed[i].pos.index, consumed[i].itemID)
+	}
+	return false
+}
+
+func hasSlotType(em *equipment.EquipmentManager, slotType string) bool {
+	for _, s := range em.GetAllSlotTypes() {
+		if s == slotType {
+			return true
+		}
+	}
+	return false
+}
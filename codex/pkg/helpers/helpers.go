@@ -5,55 +5,182 @@ import (
 	"codex/pkg/equipment"
 	"codex/pkg/iterator"
 	"codex/pkg/store"
-	"fmt"
-	"math/rand"
-	"time"
+	"sort"
+	"strings"
+	"sync"
 )
 
 var upgrades string = "upgrades"
 var upgradesIter *iterator.Iterator[string]
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// DefaultSlotTypeKey is the store key an item's slot type is read from when
+// its equipment definition doesn't name one; {id} is replaced by the item ID
+const DefaultSlotTypeKey = "{id}.slot_type"
+
+// SlotTypeSource returns the equipment slot type an upgrade goes into
+type SlotTypeSource func(itemID string) string
+
+// StoreSlotTypes returns a source that prefers the first slot type allowed by
+// the item's equipment rules, falling back to the store key built from
+// keyFormat
+func StoreSlotTypes(keyFormat string) SlotTypeSource {
+	return func(itemID string) string {
+		if def, ok := equipment.GetItem(itemID); ok && len(def.SlotTypes) > 0 {
+			return def.SlotTypes[0]
+		}
+		return store.GetStore().GetString(strings.ReplaceAll(keyFormat, "{id}", itemID))
+	}
+}
+
+// UpgradeSystem is an upgrade pool: the recipes of a crafting manager offered
+// against the loadout of an equipment manager. Each system has its own run.
+type UpgradeSystem struct {
+	ID        int
+	Crafting  string         // crafting manager holding the upgrade recipes
+	Equipment int            // equipment manager ID, 0 is the global manager
+	SlotType  SlotTypeSource // nil reads DefaultSlotTypeKey
+
+	mu  sync.Mutex
+	run *runState
+
+	levelsMu sync.RWMutex
+	levels   map[string]int // upgrade levels of the current run
+}
+
+// NewUpgradeSystem creates an unregistered upgrade system
+func NewUpgradeSystem(craftingName string, equipmentID int, slotType SlotTypeSource) *UpgradeSystem {
+	return &UpgradeSystem{
+		Crafting:  craftingName,
+		Equipment: equipmentID,
+		SlotType:  slotType,
+		run:       newRun(newSeed(), -1, -1),
+		levels:    make(map[string]int),
+	}
+}
+
+// Upgrade systems addressed by ID; ID 0 is the default system using the
+// "upgrades" crafting manager and the global equipment manager
+var (
+	systems      = make(map[int]*UpgradeSystem)
+	nextSystemID = 1
+	systemsMu    sync.RWMutex
+	defaultOnce  sync.Once
+	defaultSys   *UpgradeSystem
+)
+
+// Default returns the default upgrade system
+func Default() *UpgradeSystem {
+	defaultOnce.Do(func() {
+		defaultSys = NewUpgradeSystem(upgrades, 0, nil)
+	})
+	return defaultSys
+}
+
+// RegisterSystem registers an upgrade system and returns its ID
+func RegisterSystem(sys *UpgradeSystem) int {
+	systemsMu.Lock()
+	sys.ID = nextSystemID
+	nextSystemID++
+	systems[sys.ID] = sys
+	systemsMu.Unlock()
+
+	takePendingHistory(sys)
+	return sys.ID
+}
+
+// GetSystem returns an upgrade system by ID, or nil if it doesn't exist
+func GetSystem(id int) *UpgradeSystem {
+	if id == 0 {
+		return Default()
+	}
+	systemsMu.RLock()
+	defer systemsMu.RUnlock()
+	return systems[id]
+}
+
+// RemoveSystem deletes an upgrade system created by RegisterSystem
+func RemoveSystem(id int) bool {
+	systemsMu.Lock()
+	defer systemsMu.Unlock()
+	if _, exists := systems[id]; !exists {
+		return false
+	}
+	delete(systems, id)
+	return true
+}
+
+// equipment returns the system's equipment manager, or nil if it was removed
+func (s *UpgradeSystem) equipment() *equipment.EquipmentManager {
+	return equipment.GetInstance(s.Equipment)
+}
+
+// slotTypeOf returns the slot type an upgrade goes into
+func (s *UpgradeSystem) slotTypeOf(itemID string) string {
+	if s.SlotType != nil {
+		return s.SlotType(itemID)
+	}
+	return getEquipmentSlotType(itemID)
 }
 
+// GetUpgrades returns every upgrade that can be picked, sorted by ID
 func GetUpgrades() []string {
-	crafter, ok := crafting.Get(upgrades)
-	if !ok {
-		return []string{}
+	return Default().Upgrades()
+}
+
+// Upgrades returns every upgrade that can be picked, sorted by ID
+func (s *UpgradeSystem) Upgrades() []string {
+	upgrades, _ := s.candidates()
+	return upgrades
+}
+
+// candidates returns the sorted upgrades that can be picked and, separately,
+// those that would fill an empty slot
+func (s *UpgradeSystem) candidates() ([]string, []string) {
+	crafter, ok := crafting.Get(s.Crafting)
+	em := s.equipment()
+	if !ok || em == nil {
+		return []string{}, nil
 	}
-	equipments := equipment.GetManager().GetAllEquippedItems()
+	equipments := em.GetAllEquippedItems()
 
 	resultSet := make(map[string]struct{})
 	equippedSet := make(map[string]struct{}, len(equipments))
-
 	for _, itemID := range equipments {
 		equippedSet[itemID] = struct{}{}
+	}
+
+	// Equipped items below their cap are offered as level ups. Evolutions
+	// are only offered once their full requirement set is met.
+	for _, itemID := range equipments {
+		if _, ok := crafter.GetCraftable(itemID); ok && s.canLevelUp(itemID) {
+			resultSet[itemID] = struct{}{}
+		}
 		craftables := crafter.FindByRequirement(itemID)
 		for _, c := range craftables {
-
 			if _, already := equippedSet[c.ID]; already {
-                continue
-            }
-
+				continue
+			}
+			if !s.evolutionReady(em, c) {
+				continue
+			}
 			resultSet[c.ID] = struct{}{}
 		}
 	}
-	
 
-	if equipment.GetManager().HasAnyEmptySlot() {
+	var newSlot []string
+	if em.HasAnyEmptySlot() {
 		craftables := crafter.FindByRequirement("")
 		for _, c := range craftables {
-			
-			slotType := getEquipmentSlotType(c.ID)
-			if equipment.GetManager().GetSlotAvailability(slotType) == 0{
+			slotType := s.slotTypeOf(c.ID)
+			if em.GetSlotAvailability(slotType) == 0 {
 				continue
 			}
-
 			if _, already := equippedSet[c.ID]; already {
-                continue
-            }
-
+				continue
+			}
+			if _, dup := resultSet[c.ID]; !dup {
+				newSlot = append(newSlot, c.ID)
+			}
 			resultSet[c.ID] = struct{}{}
 		}
 	}
@@ -62,54 +189,109 @@ func GetUpgrades() []string {
 	for id := range resultSet {
 		results = append(results, id)
 	}
-
-	return results
+	sort.Strings(results)
+	sort.Strings(newSlot)
+	return results, newSlot
 }
 
+// getEquipmentSlotType returns the slot type of the default store layout
 func getEquipmentSlotType(itemID string) string {
-	keyName := fmt.Sprintf("%s.slot_type", itemID)
-	return store.GetStore().GetString(keyName)
+	return StoreSlotTypes(DefaultSlotTypeKey)(itemID)
 }
 
+// UpgrageItem picks an upgrade from the default system
 func UpgrageItem(itemID string) bool {
-	crafter, _ := crafting.Get(upgrades)
+	return Default().Pick(itemID)
+}
+
+// Kind tells what picking an upgrade would do
+func (s *UpgradeSystem) Kind(itemID string) UpgradeKind {
+	crafter, ok := crafting.Get(s.Crafting)
+	em := s.equipment()
+	if !ok || em == nil {
+		return UpgradeUnknown
+	}
 	craftable, ok := crafter.GetCraftable(itemID)
-	slotType := getEquipmentSlotType(itemID)
 	if !ok {
-		return false
+		return UpgradeUnknown
+	}
+	if _, equipped := findEquipped(em, itemID); equipped {
+		return UpgradeLevelUp
+	}
+	if len(prerequisites(craftable)) > 0 {
+		return UpgradeEvolution
 	}
+	return UpgradeNew
+}
 
-	req := craftable.Requirements[0].ID 
-	if req == "" && equipment.GetManager().GetSlotAvailability(slotType) !=0 {
-		equipment.GetManager().EquipItem(slotType, itemID)
-		return true
+// Pick applies an upgrade and records it in the run history: base items are
+// equipped into a free slot, evolutions replace the prerequisites they
+// consume and equipped items level up
+func (s *UpgradeSystem) Pick(itemID string) bool {
+	crafter, ok := crafting.Get(s.Crafting)
+	em := s.equipment()
+	if !ok || em == nil {
+		return false
 	}
-	ok = equipment.GetManager().UnequipItem(slotType, req)
+	craftable, ok := crafter.GetCraftable(itemID)
 	if !ok {
 		return false
 	}
-	ok = equipment.GetManager().EquipItem(slotType, itemID)
-	return ok
-}
+	offer := s.CurrentOffer()
 
-func getUpgradeSelections(count int) []string {
-	upgrades := GetUpgrades()
-	if len(upgrades) == 0 || count <= 0 {
-		return nil
+	switch s.Kind(itemID) {
+	case UpgradeLevelUp:
+		if s.levelUp(itemID, offer) == 0 {
+			return false
+		}
+	case UpgradeEvolution:
+		if !s.evolve(em, craftable) {
+			return false
+		}
+		var consumed []string
+		for _, req := range prerequisites(craftable) {
+			if !req.Keep {
+				consumed = append(consumed, req.ID)
+			}
+		}
+		s.forgetLevels(consumed)
+		s.log(HistoryEntry{Kind: HistoryEvolve, Item: itemID, Level: s.ItemLevel(itemID), Offer: offer, Consumed: consumed})
+	default:
+		slotType := s.slotTypeOf(itemID)
+		if em.GetSlotAvailability(slotType) == 0 || !em.EquipItem(slotType, itemID) {
+			return false
+		}
+		s.log(HistoryEntry{Kind: HistoryPick, Item: itemID, Level: s.ItemLevel(itemID), Offer: offer})
 	}
+	return true
+}
 
-	cp := append([]string(nil), upgrades...)
-	rand.Shuffle(len(cp), func(i, j int) { cp[i], cp[j] = cp[j], cp[i] })
+// GetUpgradeSelections rolls a new offer of count upgrades for the default
+// system's run and points the selections iterator at it
+func GetUpgradeSelections(count int){
+	selections := Offer(count)
+	upgradesIter = iterator.NewIterator(selections)
+}
 
-	if count > len(cp) {
-		count = len(cp)
+// RerollSelections rerolls the current offer and points the selections
+// iterator at the new one
+func RerollSelections() bool {
+	selections, ok := Reroll()
+	if !ok {
+		return false
 	}
-	return cp[:count]
+	upgradesIter = iterator.NewIterator(selections)
+	return true
 }
 
-func GetUpgradeSelections(count int){
-	selections := getUpgradeSelections(count)
-	upgradesIter = iterator.NewIterator(selections)
+// BanishSelection banishes an upgrade and points the selections iterator at
+// what remains of the current offer
+func BanishSelection(itemID string) bool {
+	if !Banish(itemID) {
+		return false
+	}
+	upgradesIter = iterator.NewIterator(CurrentOffer())
+	return true
 }
 
 func GetNextSelections() string{
@@ -118,4 +300,39 @@ func GetNextSelections() string{
 	}
 	val, _ := upgradesIter.Next()
 	return val
-}
\ No newline at end of file
+}
+
+// --------- Iterator Handles ----------
+
+var iters = iterator.NewHandles[string]()
+
+// OpenOfferIter starts an independent iteration over the current offer of
+// a system and returns its handle, or 0 if the system doesn't exist
+func OpenOfferIter(systemID int) int {
+	sys := GetSystem(systemID)
+	if sys == nil {
+		return 0
+	}
+	return iters.Open(sys.CurrentOffer())
+}
+
+// OpenUpgradesIter starts an independent iteration over every upgrade a
+// system can offer and returns its handle, or 0 if the system doesn't exist
+func OpenUpgradesIter(systemID int) int {
+	sys := GetSystem(systemID)
+	if sys == nil {
+		return 0
+	}
+	return iters.Open(sys.Upgrades())
+}
+
+// IterNext returns the next value of handle, or "" once it is exhausted
+func IterNext(handle int) string {
+	val, _ := iters.Next(handle)
+	return val
+}
+
+// CloseIter releases handle
+func CloseIter(handle int) {
+	iters.Close(handle)
+}
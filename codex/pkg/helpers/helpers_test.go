@@ -112,3 +112,413 @@ func TestGetUpgrades_ExcludesEquipped(t *testing.T) {
 	// "weapon.laser.2" should still be a valid upgrade path
 	assert.Contains(t, upgrades, "weapon.laser.2")
 }
+
+func TestUpgrageItem_EmptyRequirements(t *testing.T) {
+	crafting.LoadManagers(json.RawMessage(`{"upgrades": [{"id":"weapon.saber","requirements":[]}]}`))
+	store.GetStore().SetString("weapon.saber.slot_type", "weapon")
+
+	equipment.Clear()
+	equipment.GetManager().DefineSlot("weapon", 1)
+
+	assert.True(t, UpgrageItem("weapon.saber"))
+	assert.True(t, equipment.GetManager().IsItemEquipped("weapon", "weapon.saber"))
+	assert.False(t, UpgrageItem("weapon.unknown"))
+}
+
+func setupOffers(t *testing.T) {
+	var testJSON = `{
+	"upgrades": [
+		{"id":"weapon.laser","requirements":[{"id":"","qty":0}]},
+		{"id":"weapon.laser.2","requirements":[{"id":"weapon.laser","qty":1}]},
+		{"id":"weapon.saw","requirements":[{"id":"","qty":0}]},
+		{"id":"relic.clover","requirements":[{"id":"","qty":0}]},
+		{"id":"relic.candle","requirements":[{"id":"","qty":0}]}]
+	}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.SetString("weapon.laser.slot_type", "weapon")
+	s.SetString("weapon.laser.2.slot_type", "weapon")
+	s.SetString("weapon.saw.slot_type", "weapon")
+	s.SetString("relic.clover.slot_type", "relic")
+	s.SetString("relic.candle.slot_type", "relic")
+	s.SetString("weapon.laser.2.rarity", "legendary")
+	s.SetFloat("rarity.legendary.weight", 1000)
+
+	equipment.Clear()
+	equipment.GetManager().DefineSlot("weapon", 2)
+	equipment.GetManager().DefineSlot("relic", 1)
+	equipment.GetManager().EquipItem("weapon", "weapon.laser")
+}
+
+func TestOffersAreSeeded(t *testing.T) {
+	setupOffers(t)
+
+	StartRun(42, -1, -1)
+	first := [][]string{Offer(2), Offer(2), Offer(2)}
+	StartRun(42, -1, -1)
+	second := [][]string{Offer(2), Offer(2), Offer(2)}
+	assert.Equal(t, first, second)
+	assert.Equal(t, int64(42), RunSeed())
+}
+
+func TestOffersWeightedWithGuarantee(t *testing.T) {
+	setupOffers(t)
+	StartRun(7, -1, -1)
+
+	// Weapon slot still has room, so a filler is guaranteed, and the
+	// legendary upgrade wins the remaining pick by weight
+	legendary := 0
+	for i := 0; i < 20; i++ {
+		offer := Offer(2)
+		assert.Len(t, offer, 2)
+		if contains(offer, "weapon.laser.2") {
+			legendary++
+		}
+		filler := contains(offer, "weapon.saw") || contains(offer, "relic.clover") || contains(offer, "relic.candle")
+		assert.True(t, filler, "offer %v has no new-slot upgrade", offer)
+	}
+	assert.GreaterOrEqual(t, legendary, 18)
+
+	// A single pick still fills an empty slot
+	for i := 0; i < 10; i++ {
+		offer := Offer(1)
+		assert.NotEqual(t, []string{"weapon.laser.2"}, offer)
+	}
+}
+
+func TestRerollAndBanish(t *testing.T) {
+	setupOffers(t)
+	StartRun(1, 1, 1)
+
+	Offer(3)
+	rerolled, ok := Reroll()
+	assert.True(t, ok)
+	assert.Len(t, rerolled, 3)
+	assert.Equal(t, 0, RerollsLeft())
+	_, ok = Reroll()
+	assert.False(t, ok)
+
+	assert.True(t, Banish("relic.clover"))
+	assert.NotContains(t, CurrentOffer(), "relic.clover")
+	assert.True(t, IsBanished("relic.clover"))
+	assert.False(t, Banish("relic.candle"))
+	for i := 0; i < 10; i++ {
+		assert.NotContains(t, Offer(4), "relic.clover")
+	}
+
+	// A new run forgets banishes
+	StartRun(1, -1, -1)
+	assert.False(t, IsBanished("relic.clover"))
+	assert.True(t, RerollSelections())
+	assert.Equal(t, -1, RerollsLeft())
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMultiPrerequisiteEvolution(t *testing.T) {
+	var testJSON = `{
+	"upgrades": [
+		{"id":"weapon.whip","requirements":[{"id":"","qty":0}]},
+		{"id":"passive.hollow_heart","requirements":[{"id":"","qty":0}]},
+		{"id":"weapon.bloody_tear","requirements":[
+			{"id":"weapon.whip","qty":1,"level":3},
+			{"id":"passive.hollow_heart","qty":1,"keep":true}]}]
+	}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.Clear("weapon")
+	s.Clear("passive")
+	s.SetString("weapon.whip.slot_type", "weapon")
+	s.SetString("weapon.bloody_tear.slot_type", "weapon")
+	s.SetString("passive.hollow_heart.slot_type", "passive")
+	s.SetInt("weapon.whip.max_level", 3)
+	StartRun(1, -1, -1)
+
+	equipment.Clear()
+	em := equipment.GetManager()
+	em.DefineSlot("weapon", 1)
+	em.DefineSlot("passive", 1)
+
+	assert.True(t, UpgrageItem("weapon.whip"))
+	assert.NotContains(t, GetUpgrades(), "weapon.bloody_tear")
+	assert.False(t, UpgrageItem("weapon.bloody_tear"))
+
+	// Both items equipped, but the whip is below the required level
+	assert.True(t, UpgrageItem("passive.hollow_heart"))
+	assert.NotContains(t, GetUpgrades(), "weapon.bloody_tear")
+	assert.Equal(t, 1, ItemLevel("weapon.whip"))
+
+	assert.True(t, UpgrageItem("weapon.whip"))
+	assert.True(t, UpgrageItem("weapon.whip"))
+	assert.Equal(t, 3, ItemLevel("weapon.whip"))
+	assert.Contains(t, GetUpgrades(), "weapon.bloody_tear")
+	assert.True(t, UpgrageItem("weapon.bloody_tear"))
+	assert.Equal(t, []string{"weapon.bloody_tear"}, em.GetEquippedItems("weapon"))
+	assert.Equal(t, []string{"passive.hollow_heart"}, em.GetEquippedItems("passive"))
+	assert.NotContains(t, GetUpgrades(), "weapon.bloody_tear")
+}
+
+func TestEvolutionRollsBackWhenResultCannotEquip(t *testing.T) {
+	var testJSON = `{
+	"upgrades": [
+		{"id":"ring.a","requirements":[{"id":"","qty":0}]},
+		{"id":"ring.b","requirements":[{"id":"","qty":0}]},
+		{"id":"ring.fused","requirements":[{"id":"ring.a","qty":1},{"id":"ring.b","qty":1}]}]
+	}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.Clear("ring")
+	s.SetString("ring.a.slot_type", "ring")
+	s.SetString("ring.b.slot_type", "ring")
+	s.SetString("ring.fused.slot_type", "ring")
+
+	equipment.ResetItems()
+	defer equipment.ResetItems()
+	equipment.RegisterItem(equipment.ItemDef{ID: "ring.fused", SlotTypes: []string{"amulet"}})
+
+	equipment.Clear()
+	em := equipment.GetManager()
+	em.DefineSlot("ring", 2)
+	assert.True(t, UpgrageItem("ring.a"))
+	assert.True(t, UpgrageItem("ring.b"))
+
+	// ring.fused only fits an amulet slot, which doesn't exist
+	assert.False(t, UpgrageItem("ring.fused"))
+	assert.Equal(t, []string{"ring.a", "ring.b"}, em.GetEquippedItems("ring"))
+
+	// Evolutions into a slot type the manager doesn't define aren't offered
+	equipment.ResetItems()
+	s.SetString("ring.fused.slot_type", "charm")
+	assert.NotContains(t, GetUpgrades(), "ring.fused")
+	assert.False(t, UpgrageItem("ring.fused"))
+	assert.Equal(t, []string{"ring.a", "ring.b"}, em.GetEquippedItems("ring"))
+}
+
+func TestUpgradeSystemsSideBySide(t *testing.T) {
+	var testJSON = `{
+	"weapons": [
+		{"id":"whip","requirements":[{"id":"","qty":0}]},
+		{"id":"whip.2","requirements":[{"id":"whip","qty":1}]}],
+	"talents": [
+		{"id":"haste","requirements":[{"id":"","qty":0}]},
+		{"id":"greed","requirements":[{"id":"","qty":0}]}]
+	}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.SetString("weapons.whip.slot", "hand")
+	s.SetString("weapons.whip.2.slot", "hand")
+	s.SetString("talents.haste.slot", "talent")
+	s.SetString("talents.greed.slot", "talent")
+
+	weaponsEq := equipment.GetInstance(equipment.NewManagerInstance())
+	weaponsEq.DefineSlot("hand", 1)
+	talentsEq := equipment.GetInstance(equipment.NewManagerInstance())
+	talentsEq.DefineSlot("talent", 2)
+
+	weapons := NewUpgradeSystem("weapons", weaponsEq.ID, StoreSlotTypes("weapons.{id}.slot"))
+	talents := NewUpgradeSystem("talents", talentsEq.ID, StoreSlotTypes("talents.{id}.slot"))
+	weaponsID := RegisterSystem(weapons)
+	talentsID := RegisterSystem(talents)
+	defer RemoveSystem(weaponsID)
+	defer RemoveSystem(talentsID)
+	assert.Same(t, talents, GetSystem(talentsID))
+
+	assert.Equal(t, []string{"whip"}, weapons.Upgrades())
+	assert.Equal(t, []string{"greed", "haste"}, talents.Upgrades())
+
+	assert.True(t, weapons.Pick("whip"))
+	assert.False(t, talents.Pick("whip"))
+	assert.Equal(t, []string{"whip.2"}, weapons.Upgrades())
+	assert.Equal(t, []string{"whip"}, weaponsEq.GetAllEquippedItems())
+	assert.Empty(t, talentsEq.GetAllEquippedItems())
+
+	// Each pool keeps its own offer and iterator handle
+	weapons.StartRun(3, 0, -1)
+	talents.StartRun(3, -1, -1)
+	weapons.Offer(1)
+	talents.Offer(2)
+	wh := OpenOfferIter(weaponsID)
+	th := OpenOfferIter(talentsID)
+	defer CloseIter(wh)
+	defer CloseIter(th)
+	assert.Equal(t, "whip.2", IterNext(wh))
+	assert.Equal(t, "", IterNext(wh))
+	got := []string{IterNext(th), IterNext(th)}
+	assert.ElementsMatch(t, []string{"greed", "haste"}, got)
+
+	_, ok := weapons.Reroll()
+	assert.False(t, ok)
+	assert.Equal(t, 0, OpenOfferIter(999))
+}
+
+func TestLevelUpsAndRunHistory(t *testing.T) {
+	var testJSON = `{
+	"pool": [
+		{"id":"knife","requirements":[{"id":"","qty":0}]},
+		{"id":"knife.thousand_edge","requirements":[{"id":"knife","qty":1,"level":2}]}]
+	}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.SetString("knife.slot_type", "weapon")
+	s.SetString("knife.thousand_edge.slot_type", "weapon")
+	s.SetInt("knife.max_level", 2)
+
+	em := equipment.GetInstance(equipment.NewManagerInstance())
+	defer equipment.RemoveInstance(em.ID)
+	em.DefineSlot("weapon", 1)
+	sys := NewUpgradeSystem("pool", em.ID, nil)
+	defer RemoveSystem(RegisterSystem(sys))
+
+	sys.StartRun(5, -1, -1)
+	assert.Equal(t, UpgradeNew, sys.Kind("knife"))
+	assert.True(t, sys.Pick("knife"))
+
+	// The equipped knife is offered again as a level up
+	assert.Equal(t, []string{"knife"}, sys.Upgrades())
+	assert.Equal(t, UpgradeLevelUp, sys.Kind("knife"))
+	sys.Offer(3)
+	_, ok := sys.Reroll()
+	assert.True(t, ok)
+	assert.True(t, sys.Pick("knife"))
+	assert.Equal(t, 2, sys.ItemLevel("knife"))
+	assert.False(t, sys.Pick("knife"))
+
+	// At its cap the knife stops being offered; the evolution opens up
+	assert.Equal(t, []string{"knife.thousand_edge"}, sys.Upgrades())
+	assert.Equal(t, UpgradeEvolution, sys.Kind("knife.thousand_edge"))
+	assert.True(t, sys.Pick("knife.thousand_edge"))
+
+	var kinds []HistoryKind
+	for _, e := range sys.History() {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []HistoryKind{HistoryStart, HistoryPick, HistoryReroll, HistoryLevelUp, HistoryEvolve}, kinds)
+	history := sys.History()
+	assert.Equal(t, int64(5), history[0].Seed)
+	assert.Equal(t, 2, history[3].Level)
+	assert.Equal(t, []string{"knife"}, history[3].Offer)
+	assert.Equal(t, 5, history[4].Seq)
+
+	// The history saves and loads through storage
+	saved, err := SaveHistory()
+	assert.NoError(t, err)
+	sys.StartRun(6, -1, -1)
+	assert.Len(t, sys.History(), 1)
+	assert.NoError(t, LoadHistory(saved.(json.RawMessage)))
+	assert.Equal(t, history, sys.History())
+
+	exported, err := sys.ExportHistory()
+	assert.NoError(t, err)
+	assert.Contains(t, exported, `"kind":"level_up"`)
+}
+
+func TestRunHistoryPerSystem(t *testing.T) {
+	var testJSON = `{"party": [{"id":"sword","requirements":[{"id":"","qty":0}]}]}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	store.GetStore().SetString("sword.slot_type", "weapon")
+
+	// Two party members draw from the same crafting manager
+	var members []*UpgradeSystem
+	for i := 0; i < 2; i++ {
+		em := equipment.GetInstance(equipment.NewManagerInstance())
+		defer equipment.RemoveInstance(em.ID)
+		em.DefineSlot("weapon", 1)
+		sys := NewUpgradeSystem("party", em.ID, nil)
+		defer RemoveSystem(RegisterSystem(sys))
+		members = append(members, sys)
+	}
+	a, b := members[0], members[1]
+
+	a.StartRun(1, -1, -1)
+	assert.True(t, a.Pick("sword"))
+	b.StartRun(2, -1, -1)
+	assert.Len(t, a.History(), 2, "starting b's run leaves a's history alone")
+	assert.Len(t, b.History(), 1)
+
+	saved, err := SaveHistory()
+	assert.NoError(t, err)
+	a.StartRun(3, -1, -1)
+	b.Offer(1)
+	assert.NoError(t, LoadHistory(saved.(json.RawMessage)))
+	assert.Equal(t, HistoryPick, a.History()[1].Kind)
+	assert.Equal(t, int64(2), b.History()[0].Seed)
+
+	// A system registered after the load gets its saved history
+	bID := b.ID
+	history := b.History()
+	RemoveSystem(bID)
+	assert.NoError(t, LoadHistory(saved.(json.RawMessage)))
+	c := NewUpgradeSystem("party", 0, nil)
+	systemsMu.Lock()
+	nextSystemID = bID
+	systemsMu.Unlock()
+	defer RemoveSystem(RegisterSystem(c))
+	assert.Equal(t, history, c.History())
+}
+
+func TestLevelsPerSystemAndRun(t *testing.T) {
+	var testJSON = `{"squad": [{"id":"bow","requirements":[{"id":"","qty":0}]}]}`
+	assert.NoError(t, crafting.LoadManagers(json.RawMessage(testJSON)))
+	s := store.GetStore()
+	s.SetString("bow.slot_type", "weapon")
+	s.SetInt("bow.max_level", 5)
+
+	var members []*UpgradeSystem
+	for i := 0; i < 2; i++ {
+		em := equipment.GetInstance(equipment.NewManagerInstance())
+		defer equipment.RemoveInstance(em.ID)
+		em.DefineSlot("weapon", 1)
+		sys := NewUpgradeSystem("squad", em.ID, nil)
+		defer RemoveSystem(RegisterSystem(sys))
+		members = append(members, sys)
+	}
+	a, b := members[0], members[1]
+
+	a.StartRun(1, -1, -1)
+	b.StartRun(1, -1, -1)
+	assert.True(t, a.Pick("bow"))
+	assert.True(t, a.Pick("bow"))
+	assert.True(t, a.Pick("bow"))
+	assert.True(t, b.Pick("bow"))
+	assert.Equal(t, 3, a.ItemLevel("bow"))
+	assert.Equal(t, 1, b.ItemLevel("bow"), "party members level separately")
+	assert.Zero(t, s.GetInt("bow.level"))
+
+	saved, err := SaveHistory()
+	assert.NoError(t, err)
+
+	// A new run starts everything at level 1
+	a.StartRun(2, -1, -1)
+	assert.Equal(t, 1, a.ItemLevel("bow"))
+
+	// Loading the history brings the levels back
+	assert.NoError(t, LoadHistory(saved.(json.RawMessage)))
+	assert.Equal(t, 3, a.ItemLevel("bow"))
+	assert.Equal(t, 1, b.ItemLevel("bow"))
+
+	// Levels outlive the level ups a long run trims from its history
+	for i := 0; i < maxHistory+100; i++ {
+		_, ok := a.Reroll()
+		assert.True(t, ok)
+	}
+	assert.Len(t, a.History(), maxHistory)
+	assert.Equal(t, HistoryReroll, a.History()[0].Kind)
+	saved, err = SaveHistory()
+	assert.NoError(t, err)
+	a.StartRun(3, -1, -1)
+	assert.NoError(t, LoadHistory(saved.(json.RawMessage)))
+	assert.Equal(t, 3, a.ItemLevel("bow"))
+
+	// Older saves held only the history, which replays the levels
+	old := fmt.Sprintf(`{"%d":[{"seq":1,"kind":"start"},{"seq":2,"kind":"level_up","item":"bow","level":4}]}`, a.ID)
+	assert.NoError(t, LoadHistory(json.RawMessage(old)))
+	assert.Equal(t, 4, a.ItemLevel("bow"))
+	assert.Len(t, a.History(), 2)
+}
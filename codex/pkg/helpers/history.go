@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"bytes"
+	"codex/pkg/storage"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// HistoryKind names an action recorded in a run history
+type HistoryKind string
+
+const (
+	HistoryStart   HistoryKind = "start"
+	HistoryPick    HistoryKind = "pick"
+	HistoryLevelUp HistoryKind = "level_up"
+	HistoryEvolve  HistoryKind = "evolve"
+	HistoryReroll  HistoryKind = "reroll"
+	HistoryBanish  HistoryKind = "banish"
+)
+
+// HistoryEntry is one action of a run
+type HistoryEntry struct {
+	Seq   int         `json:"seq"`
+	Kind  HistoryKind `json:"kind"`
+	Item  string      `json:"item,omitempty"`
+	Level int         `json:"level,omitempty"` // level of Item after the action
+	Offer []string    `json:"offer,omitempty"` // offer the action was taken on, or the new offer of a reroll
+	Seed  int64       `json:"seed,omitempty"`  // seed of a started run
+
+	Consumed []string `json:"consumed,omitempty"` // prerequisites an evolution used up
+}
+
+const maxHistory = 1024
+
+// Each system keeps the history of its own run. Saves hold every registered
+// system's history and levels under its ID, 0 being the default system;
+// runs of systems that aren't registered yet wait until RegisterSystem hands
+// out their ID.
+var (
+	historyMu      sync.Mutex
+	pendingHistory = make(map[int]savedRun)
+)
+
+// savedRun is how a system's run appears in a save. The levels are saved
+// with the history because the history drops its oldest entries, level ups
+// included.
+type savedRun struct {
+	History []HistoryEntry `json:"history"`
+	Levels  map[string]int `json:"levels"`
+}
+
+// UnmarshalJSON also reads older saves, which held only the history
+func (r *savedRun) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		*r = savedRun{}
+		return json.Unmarshal(trimmed, &r.History)
+	}
+	type plain savedRun
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+func init() {
+	storage.SM().BindFuncs("upgrade_history", LoadHistory, SaveHistory)
+}
+
+// record appends an entry to the run history; s.mu must be held
+func (s *UpgradeSystem) record(entry HistoryEntry) {
+	log := s.run.history
+	entry.Seq = 1
+	if len(log) > 0 {
+		entry.Seq = log[len(log)-1].Seq + 1
+	}
+	log = append(log, entry)
+	if over := len(log) - maxHistory; over > 0 {
+		log = log[over:]
+	}
+	s.run.history = log
+}
+
+// log records an entry in the run history
+func (s *UpgradeSystem) log(entry HistoryEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(entry)
+}
+
+// History returns the system's run history, oldest first
+func (s *UpgradeSystem) History() []HistoryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]HistoryEntry(nil), s.run.history...)
+}
+
+// setHistory replaces the system's run history and levels. Runs saved
+// without levels get the levels their history replays to.
+func (s *UpgradeSystem) setHistory(run savedRun) {
+	levels := make(map[string]int, len(run.Levels))
+	for id, level := range run.Levels {
+		levels[id] = level
+	}
+	if run.Levels == nil {
+		levels = levelsFrom(run.History)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run.history = run.History
+	s.levelsMu.Lock()
+	s.levels = levels
+	s.levelsMu.Unlock()
+}
+
+// savedRun returns the system's run history and levels
+func (s *UpgradeSystem) savedRun() savedRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.levelsMu.RLock()
+	defer s.levelsMu.RUnlock()
+	run := savedRun{
+		History: append([]HistoryEntry(nil), s.run.history...),
+		Levels:  make(map[string]int, len(s.levels)),
+	}
+	for id, level := range s.levels {
+		run.Levels[id] = level
+	}
+	return run
+}
+
+// ExportHistory returns the system's run history as JSON
+func (s *UpgradeSystem) ExportHistory() (string, error) {
+	b, err := json.Marshal(s.History())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// takePendingHistory hands a loaded history to a newly registered system
+func takePendingHistory(sys *UpgradeSystem) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if run, ok := pendingHistory[sys.ID]; ok {
+		delete(pendingHistory, sys.ID)
+		sys.setHistory(run)
+	}
+}
+
+// LoadHistory replaces the run history and levels of every system in the save
+func LoadHistory(data json.RawMessage) error {
+	loaded := make(map[int]savedRun)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to unmarshal upgrade history: %w", err)
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	pendingHistory = make(map[int]savedRun)
+	for id, run := range loaded {
+		if sys := GetSystem(id); sys != nil {
+			sys.setHistory(run)
+		} else {
+			pendingHistory[id] = run
+		}
+	}
+	return nil
+}
+
+// SaveHistory returns the run history and levels of every registered system
+func SaveHistory() (any, error) {
+	all := map[int]savedRun{0: Default().savedRun()}
+	systemsMu.RLock()
+	for id, sys := range systems {
+		all[id] = sys.savedRun()
+	}
+	systemsMu.RUnlock()
+
+	b, err := json.Marshal(all)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"codex/pkg/store"
+	"fmt"
+)
+
+// Upgrade levels belong to a system's run. Every item starts a run at level 1
+// and only rises through level ups, which the run history records, so each
+// party member keeps its own levels and a complete history replays them.
+// Saves keep the levels too, since long runs trim their history. The store key
+// <item>.max_level holds the cap from data; items without a cap can't level up.
+
+// UpgradeKind tells what picking an upgrade does
+type UpgradeKind int
+
+const (
+	UpgradeUnknown   UpgradeKind = iota
+	UpgradeNew                   // equips a base item into a free slot
+	UpgradeEvolution             // replaces the prerequisites it consumes
+	UpgradeLevelUp               // raises the level of an equipped item
+)
+
+func (k UpgradeKind) String() string {
+	switch k {
+	case UpgradeNew:
+		return "new"
+	case UpgradeEvolution:
+		return "evolution"
+	case UpgradeLevelUp:
+		return "level_up"
+	}
+	return "unknown"
+}
+
+// ItemLevel returns the upgrade level of an item in the default system's run
+func ItemLevel(itemID string) int {
+	return Default().ItemLevel(itemID)
+}
+
+// ItemLevel returns the upgrade level of an item in the current run
+func (s *UpgradeSystem) ItemLevel(itemID string) int {
+	s.levelsMu.RLock()
+	defer s.levelsMu.RUnlock()
+	if level := s.levels[itemID]; level > 1 {
+		return level
+	}
+	return 1
+}
+
+// MaxLevel returns the level cap of an item from the <item>.max_level store
+// key. Items without the key are capped at level 1.
+func MaxLevel(itemID string) int {
+	level := store.GetStore().GetInt(fmt.Sprintf("%s.max_level", itemID))
+	if level < 1 {
+		return 1
+	}
+	return int(level)
+}
+
+// canLevelUp reports whether an item is below its level cap
+func (s *UpgradeSystem) canLevelUp(itemID string) bool {
+	return s.ItemLevel(itemID) < MaxLevel(itemID)
+}
+
+// levelUp raises an item one level, records it in the run history and
+// returns the new level, or 0 if the item is already at its cap
+func (s *UpgradeSystem) levelUp(itemID string, offer []string) int {
+	max := MaxLevel(itemID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.levelsMu.Lock()
+	level := s.levels[itemID]
+	if level < 1 {
+		level = 1
+	}
+	if level >= max {
+		s.levelsMu.Unlock()
+		return 0
+	}
+	level++
+	s.levels[itemID] = level
+	s.levelsMu.Unlock()
+
+	s.record(HistoryEntry{Kind: HistoryLevelUp, Item: itemID, Level: level, Offer: offer})
+	return level
+}
+
+// forgetLevels drops the levels of consumed items, which start over at 1 if
+// they are picked again
+func (s *UpgradeSystem) forgetLevels(itemIDs []string) {
+	s.levelsMu.Lock()
+	defer s.levelsMu.Unlock()
+	for _, id := range itemIDs {
+		delete(s.levels, id)
+	}
+}
+
+// levelsFrom replays the levels of a run history: every item is at the level
+// of its latest entry, and items consumed by an evolution start over
+func levelsFrom(history []HistoryEntry) map[string]int {
+	levels := make(map[string]int)
+	for _, e := range history {
+		if e.Kind == HistoryStart {
+			levels = make(map[string]int)
+		}
+		for _, id := range e.Consumed {
+			delete(levels, id)
+		}
+		if e.Item != "" && e.Level > 0 {
+			levels[e.Item] = e.Level
+		}
+	}
+	return levels
+}
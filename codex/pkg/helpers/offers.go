@@ -0,0 +1,277 @@
+package helpers
+
+import (
+	"codex/pkg/store"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Offers are drawn without replacement, weighted by rarity. An upgrade's
+// rarity is read from the <item>.rarity store key and its weight from
+// rarity.<rarity>.weight. Upgrades without a rarity, or whose rarity has no
+// positive weight, weigh 1.
+
+// runState is the offer state of a system that lasts for a single run
+type runState struct {
+	seed     int64
+	rng      *rand.Rand
+	rerolls  int // remaining, negative means unlimited
+	banishes int // remaining, negative means unlimited
+	banished map[string]struct{}
+	offer    []string
+	count    int // size requested for the current offer
+	history  []HistoryEntry
+}
+
+func newRun(seed int64, rerolls, banishes int) *runState {
+	return &runState{
+		seed:     seed,
+		rng:      rand.New(rand.NewSource(seed)),
+		rerolls:  rerolls,
+		banishes: banishes,
+		banished: make(map[string]struct{}),
+	}
+}
+
+func newSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// StartRun begins a new run of the default system
+func StartRun(seed int64, rerolls, banishes int) {
+	Default().StartRun(seed, rerolls, banishes)
+}
+
+// StartRun begins a new run whose offers are drawn from seed. Rerolls and
+// banishes are the charges available for the run, negative for unlimited.
+// Banished upgrades and upgrade levels are forgotten and the run history
+// starts over.
+func (s *UpgradeSystem) StartRun(seed int64, rerolls, banishes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = newRun(seed, rerolls, banishes)
+	s.levelsMu.Lock()
+	s.levels = make(map[string]int)
+	s.levelsMu.Unlock()
+	s.record(HistoryEntry{Kind: HistoryStart, Seed: seed})
+}
+
+// RunSeed returns the seed of the default system's run
+func RunSeed() int64 {
+	return Default().RunSeed()
+}
+
+// RunSeed returns the seed of the current run
+func (s *UpgradeSystem) RunSeed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run.seed
+}
+
+// Offer draws count upgrades from the default system
+func Offer(count int) []string {
+	return Default().Offer(count)
+}
+
+// Offer draws count upgrades for the current run and makes them the current
+// offer. Banished upgrades are never offered. While an equipment slot is
+// empty and an upgrade can fill it, at least one such upgrade is offered.
+func (s *UpgradeSystem) Offer(count int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draw(count)
+}
+
+// CurrentOffer returns the most recent offer of the default system
+func CurrentOffer() []string {
+	return Default().CurrentOffer()
+}
+
+// CurrentOffer returns the upgrades of the most recent offer
+func (s *UpgradeSystem) CurrentOffer() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.run.offer...)
+}
+
+// Reroll rerolls the default system's offer
+func Reroll() ([]string, bool) {
+	return Default().Reroll()
+}
+
+// Reroll replaces the current offer with a new draw of the same size,
+// spending one reroll charge
+func (s *UpgradeSystem) Reroll() ([]string, bool) {
+	s.mu.Lock()
+	if s.run.rerolls == 0 {
+		s.mu.Unlock()
+		return nil, false
+	}
+	if s.run.rerolls > 0 {
+		s.run.rerolls--
+	}
+	offer := s.draw(s.run.count)
+	s.record(HistoryEntry{Kind: HistoryReroll, Offer: offer})
+	s.mu.Unlock()
+	return offer, true
+}
+
+// Banish banishes an upgrade from the default system's run
+func Banish(itemID string) bool {
+	return Default().Banish(itemID)
+}
+
+// Banish removes an upgrade from the current and every later offer of the
+// run, spending one banish charge
+func (s *UpgradeSystem) Banish(itemID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.run
+	if run.banishes == 0 || itemID == "" {
+		return false
+	}
+	if _, done := run.banished[itemID]; done {
+		return false
+	}
+	s.record(HistoryEntry{Kind: HistoryBanish, Item: itemID, Offer: append([]string(nil), run.offer...)})
+	if run.banishes > 0 {
+		run.banishes--
+	}
+	run.banished[itemID] = struct{}{}
+
+	kept := run.offer[:0]
+	for _, id := range run.offer {
+		if id != itemID {
+			kept = append(kept, id)
+		}
+	}
+	run.offer = kept
+	return true
+}
+
+// IsBanished reports whether an upgrade was banished from the default system
+func IsBanished(itemID string) bool {
+	return Default().IsBanished(itemID)
+}
+
+// IsBanished reports whether an upgrade was banished this run
+func (s *UpgradeSystem) IsBanished(itemID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.run.banished[itemID]
+	return ok
+}
+
+// RerollsLeft returns the default system's remaining reroll charges
+func RerollsLeft() int {
+	return Default().RerollsLeft()
+}
+
+// RerollsLeft returns the remaining reroll charges, negative if unlimited
+func (s *UpgradeSystem) RerollsLeft() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run.rerolls
+}
+
+// BanishesLeft returns the default system's remaining banish charges
+func BanishesLeft() int {
+	return Default().BanishesLeft()
+}
+
+// BanishesLeft returns the remaining banish charges, negative if unlimited
+func (s *UpgradeSystem) BanishesLeft() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run.banishes
+}
+
+// draw rolls a new offer; s.mu must be held
+func (s *UpgradeSystem) draw(count int) []string {
+	r := s.run
+	r.count = count
+	r.offer = nil
+	if count <= 0 {
+		return nil
+	}
+
+	all, newSlot := s.candidates()
+	pool := r.allowed(all)
+	fillers := r.allowed(newSlot)
+
+	var offer []string
+	if len(fillers) > 0 {
+		pick := r.pick(fillers)
+		offer = append(offer, pick)
+		pool = without(pool, pick)
+	}
+	for len(offer) < count && len(pool) > 0 {
+		pick := r.pick(pool)
+		offer = append(offer, pick)
+		pool = without(pool, pick)
+	}
+
+	// The guaranteed pick shouldn't always be shown first
+	r.rng.Shuffle(len(offer), func(i, j int) { offer[i], offer[j] = offer[j], offer[i] })
+	r.offer = offer
+	return append([]string(nil), offer...)
+}
+
+// allowed filters out banished upgrades
+func (r *runState) allowed(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, banned := r.banished[id]; !banned {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// pick draws one of ids by rarity weight; ids must not be empty
+func (r *runState) pick(ids []string) string {
+	weights := make([]float64, len(ids))
+	total := 0.0
+	for i, id := range ids {
+		weights[i] = rarityWeight(id)
+		total += weights[i]
+	}
+
+	roll := r.rng.Float64() * total
+	for i, w := range weights {
+		if roll < w {
+			return ids[i]
+		}
+		roll -= w
+	}
+	return ids[len(ids)-1]
+}
+
+// rarityWeight returns the offer weight of an upgrade
+func rarityWeight(itemID string) float64 {
+	s := store.GetStore()
+	rarity := s.GetString(fmt.Sprintf("%s.rarity", itemID))
+	if rarity == "" {
+		return 1
+	}
+	key := fmt.Sprintf("rarity.%s.weight", rarity)
+	w := s.GetFloat(key)
+	if w == 0 {
+		w = float64(s.GetInt(key))
+	}
+	if w <= 0 {
+		return 1
+	}
+	return w
+}
+
+func without(ids []string, id string) []string {
+	out := make([]string, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -212,6 +212,46 @@ func (inv *Inventory) RemoveItem(id int, qty int) bool {
 	return qty == 0
 }
 
+// RemoveFromSlot removes qty items from a single slot. It fails without
+// changing anything if the slot holds fewer than qty items.
+func (inv *Inventory) RemoveFromSlot(slotIdx int, qty int) bool {
+	if slotIdx < 0 || slotIdx >= len(inv.Slots) || qty <= 0 {
+		return false
+	}
+	slot := inv.Slots[slotIdx]
+	if slot == nil || slot.Quantity < qty {
+		return false
+	}
+
+	slot.Quantity -= qty
+	inv.itemCounts[slot.ID] -= qty
+	if slot.Quantity == 0 {
+		inv.removePartialStack(slot.ID, slotIdx)
+		inv.Slots[slotIdx] = nil
+	} else if slot.Stackable && slot.Quantity < slot.MaxStackSize {
+		inv.addPartialStack(slot.ID, slotIdx)
+	}
+	return true
+}
+
+// PlaceInSlot puts item into an empty slot
+func (inv *Inventory) PlaceInSlot(slotIdx int, item Item) bool {
+	if slotIdx < 0 || slotIdx >= len(inv.Slots) || item.Quantity <= 0 {
+		return false
+	}
+	if slot := inv.Slots[slotIdx]; slot != nil && slot.Quantity > 0 {
+		return false
+	}
+
+	placed := item
+	inv.Slots[slotIdx] = &placed
+	inv.itemCounts[item.ID] += item.Quantity
+	if item.Stackable && item.Quantity < item.MaxStackSize {
+		inv.addPartialStack(item.ID, slotIdx)
+	}
+	return true
+}
+
 func (inv *Inventory) addPartialStack(itemID int, slotIdx int) {
 	slots := inv.partialStacks[itemID]
 	for _, idx := range slots {
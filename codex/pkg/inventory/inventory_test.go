@@ -371,3 +371,22 @@ func TestDropIntoFullStackDifferentInventory(t *testing.T) {
 	
 }
 
+
+func TestRemoveFromSlotAndPlaceInSlot(t *testing.T) {
+	inv := NewInventory(3)
+	inv.AddItem(1, true, 10, 12)
+
+	assert.False(t, inv.RemoveFromSlot(1, 3))
+	assert.True(t, inv.RemoveFromSlot(1, 2))
+	assert.Equal(t, 10, inv.CountItem(1))
+	assert.Equal(t, 10, inv.Slots[0].Quantity)
+	assert.True(t, inv.RemoveFromSlot(0, 10))
+	assert.Nil(t, inv.Slots[0])
+	assert.Equal(t, 0, inv.CountItem(1))
+	assert.False(t, inv.RemoveFromSlot(5, 1))
+
+	assert.True(t, inv.PlaceInSlot(0, Item{ID: 2, Quantity: 1, MaxStackSize: 1}))
+	assert.False(t, inv.PlaceInSlot(0, Item{ID: 3, Quantity: 1, MaxStackSize: 1}))
+	assert.Equal(t, 1, inv.CountItem(2))
+	assert.Equal(t, 2, inv.Slots[0].ID)
+}
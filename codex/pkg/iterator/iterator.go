@@ -1,5 +1,7 @@
 package iterator
 
+import "sync"
+
 // Iterator holds state for generic iteration.
 type Iterator[T any] struct {
 	data []T
@@ -30,3 +32,64 @@ func (it *Iterator[T]) Next() (T, bool) {
 func (it *Iterator[T]) Reset() {
 	it.curr = 0
 }
+
+// Len returns the total number of elements.
+func (it *Iterator[T]) Len() int {
+	return len(it.data)
+}
+
+// Handles hands out integer handles to independent iterators so several
+// callers across the C boundary can iterate at the same time. Handle 0 is
+// never used and always reads as exhausted.
+type Handles[T any] struct {
+	mu    sync.Mutex
+	next  int
+	iters map[int]*Iterator[T]
+}
+
+// NewHandles creates an empty handle table.
+func NewHandles[T any]() *Handles[T] {
+	return &Handles[T]{
+		next:  1,
+		iters: make(map[int]*Iterator[T]),
+	}
+}
+
+// Open creates an iterator over items and returns its handle.
+func (h *Handles[T]) Open(items []T) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.next
+	h.next++
+	h.iters[id] = NewIterator(items)
+	return id
+}
+
+// Next advances the iterator behind handle.
+func (h *Handles[T]) Next(handle int) (T, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	it, ok := h.iters[handle]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return it.Next()
+}
+
+// Len returns the number of elements behind handle, or 0 if it is unknown.
+func (h *Handles[T]) Len(handle int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if it, ok := h.iters[handle]; ok {
+		return it.Len()
+	}
+	return 0
+}
+
+// Close releases handle. Closing an unknown handle is a no-op.
+func (h *Handles[T]) Close(handle int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.iters, handle)
+}
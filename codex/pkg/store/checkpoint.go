@@ -0,0 +1,175 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// A checkpoint is a named copy of the store or of one prefix, taken with
+// Checkpoint and put back with RestoreCheckpoint. Taking one copies the
+// entries but not their values: writes always replace values, so lists and
+// strings can be shared with the live store. Restored TTLs get the time they
+// had left when the checkpoint was taken.
+
+type checkpoint struct {
+	prefix  string
+	entries map[string]StoreEntry
+	ttls    map[string]float64 // game time left
+	persist bool
+}
+
+// savedCheckpoint is how a persisted checkpoint appears in a save
+type savedCheckpoint struct {
+	Prefix string       `json:"prefix"`
+	Values GroupedStore `json:"values"`
+}
+
+// normalizePrefix accepts prefixes written with a trailing dot, like "run."
+func normalizePrefix(prefix string) string {
+	return strings.TrimSuffix(prefix, ".")
+}
+
+// Checkpoint copies every key under prefix, or the whole store for an empty
+// prefix, into the named checkpoint, replacing any checkpoint of that name.
+// Persisted checkpoints are written by Save and come back with Load.
+func (s *Store) Checkpoint(name, prefix string, persist bool) {
+	prefix = normalizePrefix(prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := &checkpoint{
+		prefix:  prefix,
+		entries: make(map[string]StoreEntry),
+		ttls:    make(map[string]float64),
+		persist: persist,
+	}
+	n := s.root
+	if prefix != "" {
+		n = s.getNode(prefix)
+	}
+	if n != nil {
+		flatten(prefix, n, cp.entries)
+	}
+	for key := range cp.entries {
+		if left, ok := s.ttl(key); ok {
+			cp.ttls[key] = left
+		}
+	}
+
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]*checkpoint)
+	}
+	s.checkpoints[name] = cp
+}
+
+// RestoreCheckpoint replaces everything under the checkpoint's prefix with
+// its copy. Keys created since the checkpoint are removed. The checkpoint is
+// kept so it can be restored again.
+func (s *Store) RestoreCheckpoint(name string) bool {
+	var changes []Change
+	ok := func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		cp, ok := s.checkpoints[name]
+		if !ok {
+			return false
+		}
+		removed := s.removeSubtree(cp.prefix)
+		s.clock.forget(removed)
+		for key, e := range cp.entries {
+			e := e
+			s.getOrCreateNode(key).entry = &e
+		}
+		s.restoreTTLs(cp.ttls)
+		s.invalidateAll()
+		changes = diffEntries(removed, cp.entries)
+		return true
+	}()
+	s.notify(changes)
+	return ok
+}
+
+// DeleteCheckpoint forgets a checkpoint
+func (s *Store) DeleteCheckpoint(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.checkpoints[name]; !ok {
+		return false
+	}
+	delete(s.checkpoints, name)
+	return true
+}
+
+// Checkpoints returns the names of every checkpoint, sorted
+func (s *Store) Checkpoints() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.checkpoints))
+	for name := range s.checkpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckpointPrefix returns the prefix a checkpoint covers
+func (s *Store) CheckpointPrefix(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp, ok := s.checkpoints[name]
+	if !ok {
+		return "", false
+	}
+	return cp.prefix, true
+}
+
+// savedCheckpoints returns the persisted checkpoints in save form; s.mu must
+// be held
+func (s *Store) savedCheckpoints() map[string]savedCheckpoint {
+	saved := make(map[string]savedCheckpoint)
+	for name, cp := range s.checkpoints {
+		if !cp.persist {
+			continue
+		}
+		values := newGroupedStore()
+		for key, e := range cp.entries {
+			values.add(key, e)
+		}
+		for key, left := range cp.ttls {
+			values.TTLs[key] = left
+		}
+		saved[name] = savedCheckpoint{Prefix: cp.prefix, Values: values}
+	}
+	if len(saved) == 0 {
+		return nil
+	}
+	return saved
+}
+
+// loadCheckpoints replaces the persisted checkpoints with the saved ones.
+// Checkpoints that were never persisted are kept unless the save has one of
+// the same name. s.mu must be held.
+func (s *Store) loadCheckpoints(saved map[string]savedCheckpoint) {
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]*checkpoint, len(saved))
+	}
+	for name, cp := range s.checkpoints {
+		if cp.persist {
+			delete(s.checkpoints, name)
+		}
+	}
+	for name, sc := range saved {
+		ttls := make(map[string]float64, len(sc.Values.TTLs))
+		for key, left := range sc.Values.TTLs {
+			ttls[key] = left
+		}
+		s.checkpoints[name] = &checkpoint{
+			prefix:  normalizePrefix(sc.Prefix),
+			entries: sc.Values.entries(),
+			ttls:    ttls,
+			persist: true,
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Formula entries hold an expression over other keys, for example
+// "player.base_damage * (1 + player.damage_bonus)". They are evaluated when
+// read through GetFloat or GetInt and the result is cached until one of the
+// keys the formula depends on, directly or through other formulas, changes.
+//
+// Expressions support numbers, key references, + - * /, unary minus,
+// parentheses and the functions min, max, abs, floor, ceil, round and clamp.
+// References read ints, floats and formulas; bools count as 0 or 1 and any
+// other or missing key as 0. Division by zero yields 0.
+
+// ErrFormulaCycle is returned when a formula would depend on itself
+var ErrFormulaCycle = errors.New("store: formula cycle")
+
+type formula struct {
+	root exprNode
+	deps []string // referenced keys, sorted and unique
+}
+
+type formulaState struct {
+	mu       sync.Mutex
+	compiled map[string]*formula // by expression text
+	cache    map[string]float64  // by formula key
+}
+
+// compile parses expr, reusing an earlier parse of the same text
+func (s *Store) compile(expr string) (*formula, error) {
+	fs := &s.formulas
+	fs.mu.Lock()
+	f, ok := fs.compiled[expr]
+	fs.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+
+	f, err := parseFormula(expr)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	if fs.compiled == nil {
+		fs.compiled = make(map[string]*formula)
+	}
+	fs.compiled[expr] = f
+	fs.mu.Unlock()
+	return f, nil
+}
+
+// formulaAt returns the compiled formula stored at key; s.mu must be held
+func (s *Store) formulaAt(key string) *formula {
+	n := s.getNode(key)
+	if n == nil || n.entry == nil || n.entry.Type != FormulaType {
+		return nil
+	}
+	f, err := s.compile(n.entry.Value.(string))
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// reaches reports whether key is target or depends on it; s.mu must be held
+func (s *Store) reaches(key, target string, seen map[string]bool) bool {
+	if key == target {
+		return true
+	}
+	if seen[key] {
+		return false
+	}
+	seen[key] = true
+	f := s.formulaAt(key)
+	if f == nil {
+		return false
+	}
+	for _, dep := range f.deps {
+		if s.reaches(dep, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFormula compiles expr and makes sure storing it at key creates no
+// cycle; s.mu must be held
+func (s *Store) checkFormula(key, expr string) error {
+	f, err := s.compile(expr)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, dep := range f.deps {
+		if s.reaches(dep, key, seen) {
+			return fmt.Errorf("%w: %s depends on itself through %s", ErrFormulaCycle, key, dep)
+		}
+	}
+	return nil
+}
+
+// evalFormula returns the value of the formula at key; s.mu must be held
+func (s *Store) evalFormula(key string) float64 {
+	return s.formulaValue(key, make(map[string]bool))
+}
+
+func (s *Store) formulaValue(key string, visiting map[string]bool) float64 {
+	fs := &s.formulas
+	fs.mu.Lock()
+	v, ok := fs.cache[key]
+	fs.mu.Unlock()
+	if ok {
+		return v
+	}
+
+	f := s.formulaAt(key)
+	if f == nil || visiting[key] {
+		return 0 // invalid formula or a cycle loaded from data
+	}
+	visiting[key] = true
+	v = f.root.eval(func(ref string) float64 { return s.numeric(ref, visiting) })
+	delete(visiting, key)
+
+	fs.mu.Lock()
+	if fs.cache == nil {
+		fs.cache = make(map[string]float64)
+	}
+	fs.cache[key] = v
+	fs.mu.Unlock()
+	return v
+}
+
+// numeric returns the value a formula reference reads; s.mu must be held
+func (s *Store) numeric(key string, visiting map[string]bool) float64 {
+	e := s.lookup(key)
+	if e == nil {
+		return 0
+	}
+	switch e.Type {
+	case IntType:
+		return float64(e.Value.(int64))
+	case FloatType:
+		return e.Value.(float64)
+	case BoolType:
+		if e.Value.(bool) {
+			return 1
+		}
+	case FormulaType:
+		return s.formulaValue(key, visiting)
+	}
+	return 0
+}
+
+// invalidate drops the cached results of formulas depending on key; s.mu
+// must be held for writing
+func (s *Store) invalidate(key string) {
+	fs := &s.formulas
+	fs.mu.Lock()
+	cached := make([]string, 0, len(fs.cache))
+	for k := range fs.cache {
+		cached = append(cached, k)
+	}
+	fs.mu.Unlock()
+
+	var stale []string
+	for _, k := range cached {
+		if s.reaches(k, key, make(map[string]bool)) {
+			stale = append(stale, k)
+		}
+	}
+
+	fs.mu.Lock()
+	for _, k := range stale {
+		delete(fs.cache, k)
+	}
+	fs.mu.Unlock()
+}
+
+// invalidateAll drops every cached formula result; s.mu must be held for
+// writing
+func (s *Store) invalidateAll() {
+	fs := &s.formulas
+	fs.mu.Lock()
+	fs.cache = nil
+	fs.mu.Unlock()
+}
+
+// ---- Tx ----
+
+// SetFormula stores expr at key. It fails if expr doesn't parse or would
+// make a formula depend on itself.
+func (tx *Tx) SetFormula(key, expr string) error {
+	if err := tx.s.checkFormula(key, expr); err != nil {
+		return err
+	}
+	return tx.set(key, StoreEntry{Type: FormulaType, Value: expr})
+}
+
+// ---- Store ----
+
+// SetFormula stores expr at key. It fails if expr doesn't parse or would
+// make a formula depend on itself.
+func (s *Store) SetFormula(key, expr string) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.SetFormula(key, expr)
+	})
+}
+
+// GetFormula returns the expression stored at key, or "" if key holds no
+// formula
+func (s *Store) GetFormula(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n := s.getNode(key); n != nil && n.entry != nil && n.entry.Type == FormulaType {
+		return n.entry.Value.(string)
+	}
+	return ""
+}
+
+// Dependencies returns the keys the formula at key references directly
+func (s *Store) Dependencies(key string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f := s.formulaAt(key)
+	if f == nil {
+		return nil
+	}
+	return append([]string(nil), f.deps...)
+}
+
+// validateFormulas returns an error naming every formula that doesn't parse
+// or depends on itself; s.mu must be held
+func (s *Store) validateFormulas(formulas map[string]string) error {
+	var bad []string
+	for key, expr := range formulas {
+		if err := s.checkFormula(key, expr); err != nil {
+			bad = append(bad, err.Error())
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	sort.Strings(bad)
+	return fmt.Errorf("invalid formulas: %s", strings.Join(bad, "; "))
+}
+
+// ---- Parsing ----
+
+type exprNode interface {
+	eval(lookup func(key string) float64) float64
+}
+
+type numberNode float64
+
+func (n numberNode) eval(func(string) float64) float64 { return float64(n) }
+
+type refNode string
+
+func (n refNode) eval(lookup func(string) float64) float64 { return lookup(string(n)) }
+
+type negNode struct{ x exprNode }
+
+func (n negNode) eval(lookup func(string) float64) float64 { return -n.x.eval(lookup) }
+
+type binaryNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binaryNode) eval(lookup func(string) float64) float64 {
+	l, r := n.l.eval(lookup), n.r.eval(lookup)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	default:
+		if r == 0 {
+			return 0
+		}
+		return l / r
+	}
+}
+
+type callNode struct {
+	fn   string
+	args []exprNode
+}
+
+// formulaFuncs maps each function to its argument count; -1 takes one or more
+var formulaFuncs = map[string]int{
+	"min": -1, "max": -1, "abs": 1, "floor": 1, "ceil": 1, "round": 1, "clamp": 3,
+}
+
+func (n callNode) eval(lookup func(string) float64) float64 {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(lookup)
+	}
+	switch n.fn {
+	case "min":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Min(v, a)
+		}
+		return v
+	case "max":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Max(v, a)
+		}
+		return v
+	case "abs":
+		return math.Abs(args[0])
+	case "floor":
+		return math.Floor(args[0])
+	case "ceil":
+		return math.Ceil(args[0])
+	case "round":
+		return math.Round(args[0])
+	default: // clamp
+		return math.Max(args[1], math.Min(args[2], args[0]))
+	}
+}
+
+type formulaParser struct {
+	expr string
+	pos  int
+	deps map[string]struct{}
+}
+
+func parseFormula(expr string) (*formula, error) {
+	p := &formulaParser{expr: expr, deps: make(map[string]struct{})}
+	root, err := p.parseSum()
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.expr) {
+			err = p.errorf("unexpected %q", p.expr[p.pos])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]string, 0, len(p.deps))
+	for dep := range p.deps {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return &formula{root: root, deps: deps}, nil
+}
+
+func (p *formulaParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("store: formula %q at %d: %s", p.expr, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek skips spaces and returns the next byte, or 0 at the end
+func (p *formulaParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return p.expr[p.pos]
+	}
+	return 0
+}
+
+func (p *formulaParser) parseSum() (exprNode, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '+' || c == '-'; c = p.peek() {
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode{op: c, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *formulaParser) parseProduct() (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '*' || c == '/'; c = p.peek() {
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode{op: c, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *formulaParser) parseUnary() (exprNode, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parseOperand()
+}
+
+func (p *formulaParser) parseOperand() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.expr) && (isDigit(p.expr[p.pos]) || p.expr[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.expr[start:p.pos]
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("bad number %q", text)
+		}
+		return numberNode(v), nil
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.expr) && (isIdentStart(p.expr[p.pos]) || isDigit(p.expr[p.pos]) || p.expr[p.pos] == '.') {
+			p.pos++
+		}
+		name := p.expr[start:p.pos]
+		if p.peek() == '(' {
+			return p.parseCall(name)
+		}
+		if strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+			return nil, p.errorf("bad key %q", name)
+		}
+		p.deps[name] = struct{}{}
+		return refNode(name), nil
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *formulaParser) parseCall(name string) (exprNode, error) {
+	arity, ok := formulaFuncs[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.pos++ // (
+	var args []exprNode
+	if p.peek() != ')' {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("missing )")
+	}
+	p.pos++
+	if (arity < 0 && len(args) == 0) || (arity > 0 && len(args) != arity) {
+		return nil, p.errorf("wrong number of arguments to %s", name)
+	}
+	return callNode{fn: name, args: args}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
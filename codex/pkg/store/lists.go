@@ -0,0 +1,209 @@
+package store
+
+import (
+	"codex/pkg/iterator"
+)
+
+// Lists are stored as a single value. Every write replaces the slice, so
+// lists handed out by getters and changes are never modified afterwards.
+// Appending to a key that holds another type replaces it with a new list.
+
+// getStringList returns the list at key without copying; s.mu must be held
+func (s *Store) getStringList(key string) []string {
+	if e := s.lookup(key); e != nil && e.Type == StringListType {
+		return e.Value.([]string)
+	}
+	return nil
+}
+
+// getIntList returns the list at key without copying; s.mu must be held
+func (s *Store) getIntList(key string) []int64 {
+	if e := s.lookup(key); e != nil && e.Type == IntListType {
+		return e.Value.([]int64)
+	}
+	return nil
+}
+
+// ---- Tx ----
+
+func (tx *Tx) GetStringList(key string) []string {
+	return append([]string(nil), tx.s.getStringList(key)...)
+}
+
+func (tx *Tx) GetIntList(key string) []int64 {
+	return append([]int64(nil), tx.s.getIntList(key)...)
+}
+
+func (tx *Tx) SetStringList(key string, val []string) error {
+	return tx.set(key, StoreEntry{Type: StringListType, Value: append([]string{}, val...)})
+}
+
+func (tx *Tx) SetIntList(key string, val []int64) error {
+	return tx.set(key, StoreEntry{Type: IntListType, Value: append([]int64{}, val...)})
+}
+
+func (tx *Tx) AppendString(key string, val string) error {
+	return tx.SetStringList(key, append(tx.GetStringList(key), val))
+}
+
+func (tx *Tx) AppendInt(key string, val int64) error {
+	return tx.SetIntList(key, append(tx.GetIntList(key), val))
+}
+
+// RemoveString removes the first occurrence of val and reports whether it was found
+func (tx *Tx) RemoveString(key string, val string) bool {
+	list := tx.s.getStringList(key)
+	for i, v := range list {
+		if v == val {
+			out := make([]string, 0, len(list)-1)
+			out = append(out, list[:i]...)
+			return tx.SetStringList(key, append(out, list[i+1:]...)) == nil
+		}
+	}
+	return false
+}
+
+// RemoveInt removes the first occurrence of val and reports whether it was found
+func (tx *Tx) RemoveInt(key string, val int64) bool {
+	list := tx.s.getIntList(key)
+	for i, v := range list {
+		if v == val {
+			out := make([]int64, 0, len(list)-1)
+			out = append(out, list[:i]...)
+			return tx.SetIntList(key, append(out, list[i+1:]...)) == nil
+		}
+	}
+	return false
+}
+
+// ---- Store ----
+
+func (s *Store) SetStringList(key string, val []string) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.SetStringList(key, val)
+	})
+}
+
+func (s *Store) SetIntList(key string, val []int64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.SetIntList(key, val)
+	})
+}
+
+// GetStringList returns a copy of the string list at key
+func (s *Store) GetStringList(key string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.getStringList(key)...)
+}
+
+// GetIntList returns a copy of the int list at key
+func (s *Store) GetIntList(key string) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]int64(nil), s.getIntList(key)...)
+}
+
+func (s *Store) AppendString(key string, val string) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.AppendString(key, val)
+	})
+}
+
+func (s *Store) AppendInt(key string, val int64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.AppendInt(key, val)
+	})
+}
+
+// RemoveString removes the first occurrence of val and reports whether it
+// was removed. The error tells a refused write from a missing value.
+func (s *Store) RemoveString(key string, val string) (bool, error) {
+	removed := false
+	err := s.Update(func(tx *Tx) error {
+		removed = tx.RemoveString(key, val)
+		return nil
+	})
+	return removed && err == nil, err
+}
+
+// RemoveInt removes the first occurrence of val like RemoveString
+func (s *Store) RemoveInt(key string, val int64) (bool, error) {
+	removed := false
+	err := s.Update(func(tx *Tx) error {
+		removed = tx.RemoveInt(key, val)
+		return nil
+	})
+	return removed && err == nil, err
+}
+
+func (s *Store) ContainsString(key string, val string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.getStringList(key) {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) ContainsInt(key string, val int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.getIntList(key) {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// ListLen returns the length of the string or int list at key, or 0 if key
+// holds no list
+func (s *Store) ListLen(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if list := s.getStringList(key); list != nil {
+		return len(list)
+	}
+	return len(s.getIntList(key))
+}
+
+// ---- Iterator Handles ----
+
+var (
+	iters    = iterator.NewHandles[string]()
+	intIters = iterator.NewHandles[int64]()
+)
+
+// OpenIter starts an independent iteration over values and returns its handle
+func OpenIter(values []string) int {
+	return iters.Open(values)
+}
+
+// IterNext returns the next value of handle, or "" once it is exhausted
+func IterNext(handle int) string {
+	val, _ := iters.Next(handle)
+	return val
+}
+
+// CloseIter releases a handle returned by OpenIter
+func CloseIter(handle int) {
+	iters.Close(handle)
+}
+
+// OpenIntIter starts an independent iteration over values and returns its handle
+func OpenIntIter(values []int64) int {
+	return intIters.Open(values)
+}
+
+// IntIterNext returns the next value of handle and false once it is exhausted
+func IntIterNext(handle int) (int64, bool) {
+	return intIters.Next(handle)
+}
+
+// CloseIntIter releases a handle returned by OpenIntIter
+func CloseIntIter(handle int) {
+	intIters.Close(handle)
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Query selects keys holding a value. Pattern segments are matched one key
+// segment at a time: "*" matches any segment, "**" any number of segments
+// (including none), and other segments may use the wildcards of path.Match,
+// so "items.*.slot_type", "**.chance" and "items.sword_*.price" all work.
+type Query struct {
+	Pattern string
+	Types   []ValueType // empty matches every type
+	// Min and Max bound numeric values to [Min, Max); setting either keeps
+	// only ints, floats and formulas
+	Min, Max *float64
+}
+
+// Find returns the keys matching q, sorted
+func (s *Store) Find(q Query) []string {
+	if q.Pattern == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[string]struct{})
+	s.match(s.root, "", strings.Split(q.Pattern, "."), func(key string, e *StoreEntry) {
+		if s.accepts(q, key, e) {
+			found[key] = struct{}{}
+		}
+	})
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Match returns the keys matching pattern, sorted
+func (s *Store) Match(pattern string) []string {
+	return s.Find(Query{Pattern: pattern})
+}
+
+// AllKeys returns every key holding a value under prefix, at any depth,
+// sorted. An empty prefix lists the whole store.
+func (s *Store) AllKeys(prefix string) []string {
+	if prefix == "" {
+		return s.Match("**")
+	}
+	return s.Match(prefix + ".**")
+}
+
+// match calls fn for every entry below n whose key matches parts; s.mu must
+// be held
+func (s *Store) match(n *node, key string, parts []string, fn func(string, *StoreEntry)) {
+	if len(parts) == 0 {
+		if n.entry != nil {
+			fn(key, n.entry)
+		}
+		return
+	}
+	part, rest := parts[0], parts[1:]
+	if !strings.ContainsAny(part, `*?[\`) {
+		if child := n.children[part]; child != nil {
+			childKey := part
+			if key != "" {
+				childKey = key + "." + part
+			}
+			s.match(child, childKey, rest, fn)
+		}
+		return
+	}
+	if part == "**" {
+		s.match(n, key, rest, fn)
+	}
+	for name, child := range n.children {
+		childKey := name
+		if key != "" {
+			childKey = key + "." + name
+		}
+		switch part {
+		case "**":
+			s.match(child, childKey, parts, fn)
+		case "*":
+			s.match(child, childKey, rest, fn)
+		default:
+			if ok, _ := path.Match(part, name); ok {
+				s.match(child, childKey, rest, fn)
+			}
+		}
+	}
+}
+
+// accepts reports whether an entry passes the type and range filters of q;
+// s.mu must be held
+func (s *Store) accepts(q Query, key string, e *StoreEntry) bool {
+	if len(q.Types) > 0 {
+		typed := false
+		for _, t := range q.Types {
+			if e.Type == t {
+				typed = true
+				break
+			}
+		}
+		if !typed {
+			return false
+		}
+	}
+	if q.Min == nil && q.Max == nil {
+		return true
+	}
+
+	v, ok := s.number(key)
+	if !ok {
+		return false
+	}
+	return (q.Min == nil || v >= *q.Min) && (q.Max == nil || v < *q.Max)
+}
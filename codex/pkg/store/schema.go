@@ -0,0 +1,304 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"path"
+	"strings"
+)
+
+// A schema guards writes made through setters and transactions. Each rule
+// applies to the keys matching its pattern, written like Query patterns;
+// the first matching rule wins. Writes of the wrong type or to read-only
+// keys fail, and numbers outside [min, max] are clamped. Missing keys read
+// as the rule's default. Load, Clear and checkpoint restores are trusted
+// and bypass the schema, so configs can still author read-only keys.
+
+var (
+	// ErrReadOnly is returned when writing a key the schema marks read-only
+	ErrReadOnly = errors.New("store: key is read-only")
+	// ErrSchemaType is returned when writing a value of the wrong type
+	ErrSchemaType = errors.New("store: wrong value type")
+)
+
+// SchemaRule declares the keys matching Pattern. Type is one of int, float,
+// bool, string, string_list, int_list or formula; empty allows any type.
+// Formulas may also be written to int and float keys.
+type SchemaRule struct {
+	Pattern  string   `json:"pattern" yaml:"pattern"`
+	Type     string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Default  any      `json:"default,omitempty" yaml:"default,omitempty"`
+	Min      *float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty" yaml:"max,omitempty"`
+	ReadOnly bool     `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+}
+
+type Schema struct {
+	Keys []SchemaRule `json:"keys" yaml:"keys"`
+}
+
+var typeNames = map[string]ValueType{
+	"int":         IntType,
+	"float":       FloatType,
+	"bool":        BoolType,
+	"string":      StringType,
+	"string_list": StringListType,
+	"int_list":    IntListType,
+	"formula":     FormulaType,
+}
+
+func (t ValueType) String() string {
+	for name, typ := range typeNames {
+		if typ == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("ValueType(%d)", int(t))
+}
+
+type schemaRule struct {
+	SchemaRule
+	parts []string
+	typ   ValueType
+	typed bool
+	def   *StoreEntry
+}
+
+// ParseSchema reads a schema written in YAML or JSON
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// LoadSchema parses a YAML or JSON schema and applies it
+func (s *Store) LoadSchema(data []byte) error {
+	schema, err := ParseSchema(data)
+	if err != nil {
+		return err
+	}
+	return s.SetSchema(schema)
+}
+
+// SetSchema replaces the store's schema; nil removes it. Values already in
+// the store are not checked.
+func (s *Store) SetSchema(schema *Schema) error {
+	var rules []*schemaRule
+	if schema != nil {
+		for i, r := range schema.Keys {
+			rule, err := compileRule(r)
+			if err != nil {
+				return fmt.Errorf("schema rule %d (%s): %w", i, r.Pattern, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = rules
+	s.invalidateAll() // formulas may read new defaults
+	return nil
+}
+
+func compileRule(r SchemaRule) (*schemaRule, error) {
+	if r.Pattern == "" {
+		return nil, errors.New("missing pattern")
+	}
+	rule := &schemaRule{SchemaRule: r, parts: strings.Split(r.Pattern, ".")}
+	if r.Type != "" {
+		typ, ok := typeNames[r.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", r.Type)
+		}
+		rule.typ, rule.typed = typ, true
+	}
+	if r.Min != nil || r.Max != nil {
+		if rule.typed && rule.typ != IntType && rule.typ != FloatType {
+			return nil, fmt.Errorf("bounds need a numeric type, not %s", r.Type)
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return nil, errors.New("min is above max")
+		}
+	}
+	if r.Default != nil {
+		if !rule.typed || rule.typ == FormulaType {
+			return nil, errors.New("defaults need an int, float, bool, string or list type")
+		}
+		def, ok := defaultEntry(rule.typ, r.Default)
+		if !ok {
+			return nil, fmt.Errorf("default %v is not a %s", r.Default, r.Type)
+		}
+		clamped := def
+		rule.clamp(&clamped)
+		if !sameEntry(def, clamped) {
+			return nil, fmt.Errorf("default %v is out of bounds", r.Default)
+		}
+		rule.def = &def
+	}
+	return rule, nil
+}
+
+// defaultEntry converts a decoded default to an entry of type typ
+func defaultEntry(typ ValueType, raw any) (StoreEntry, bool) {
+	switch typ {
+	case IntType:
+		if v, ok := toInt(raw); ok {
+			return StoreEntry{Type: IntType, Value: v}, true
+		}
+	case FloatType:
+		switch v := raw.(type) {
+		case int:
+			return StoreEntry{Type: FloatType, Value: float64(v)}, true
+		case float64:
+			return StoreEntry{Type: FloatType, Value: math.Round(v*100) / 100}, true
+		}
+	case BoolType:
+		if v, ok := raw.(bool); ok {
+			return StoreEntry{Type: BoolType, Value: v}, true
+		}
+	case StringType:
+		if v, ok := raw.(string); ok {
+			return StoreEntry{Type: StringType, Value: v}, true
+		}
+	case StringListType:
+		items, ok := raw.([]any)
+		if !ok {
+			return StoreEntry{}, false
+		}
+		list := make([]string, len(items))
+		for i, item := range items {
+			if list[i], ok = item.(string); !ok {
+				return StoreEntry{}, false
+			}
+		}
+		return StoreEntry{Type: StringListType, Value: list}, true
+	case IntListType:
+		items, ok := raw.([]any)
+		if !ok {
+			return StoreEntry{}, false
+		}
+		list := make([]int64, len(items))
+		for i, item := range items {
+			if list[i], ok = toInt(item); !ok {
+				return StoreEntry{}, false
+			}
+		}
+		return StoreEntry{Type: IntListType, Value: list}, true
+	}
+	return StoreEntry{}, false
+}
+
+func toInt(raw any) (int64, bool) {
+	switch v := raw.(type) {
+	case int:
+		return int64(v), true
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+// clamp brings an int or float entry inside the rule's bounds
+func (r *schemaRule) clamp(e *StoreEntry) {
+	switch e.Type {
+	case IntType:
+		v := e.Value.(int64)
+		if r.Min != nil && float64(v) < *r.Min {
+			v = int64(math.Ceil(*r.Min))
+		}
+		if r.Max != nil && float64(v) > *r.Max {
+			v = int64(math.Floor(*r.Max))
+		}
+		e.Value = v
+	case FloatType:
+		v := e.Value.(float64)
+		if r.Min != nil && v < *r.Min {
+			v = *r.Min
+		}
+		if r.Max != nil && v > *r.Max {
+			v = *r.Max
+		}
+		e.Value = v
+	}
+}
+
+// matchKey reports whether key matches the pattern segments
+func matchKey(parts, key []string) bool {
+	if len(parts) == 0 {
+		return len(key) == 0
+	}
+	if parts[0] == "**" {
+		for i := 0; i <= len(key); i++ {
+			if matchKey(parts[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(key) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(parts[0], key[0]); !ok {
+		return false
+	}
+	return matchKey(parts[1:], key[1:])
+}
+
+// ruleFor returns the first rule matching key; s.mu must be held
+func (s *Store) ruleFor(key string) *schemaRule {
+	if len(s.schema) == 0 {
+		return nil
+	}
+	parts := strings.Split(key, ".")
+	for _, r := range s.schema {
+		if matchKey(r.parts, parts) {
+			return r
+		}
+	}
+	return nil
+}
+
+// applySchema checks a write of e to key and clamps it in place; s.mu must
+// be held
+func (s *Store) applySchema(key string, e *StoreEntry) error {
+	r := s.ruleFor(key)
+	if r == nil {
+		return nil
+	}
+	if r.ReadOnly {
+		return fmt.Errorf("%w: %s", ErrReadOnly, key)
+	}
+	if r.typed && e.Type != r.typ {
+		numeric := r.typ == IntType || r.typ == FloatType
+		if !(numeric && e.Type == FormulaType) {
+			return fmt.Errorf("%w: %s holds %s, not %s", ErrSchemaType, key, r.typ, e.Type)
+		}
+	}
+	r.clamp(e)
+	return nil
+}
+
+// writable reports whether the schema lets key be written; s.mu must be held
+func (s *Store) writable(key string) bool {
+	r := s.ruleFor(key)
+	return r == nil || !r.ReadOnly
+}
+
+// lookup returns the entry at key, or the schema default when the key is
+// missing; s.mu must be held
+func (s *Store) lookup(key string) *StoreEntry {
+	if n := s.getNode(key); n != nil && n.entry != nil {
+		return n.entry
+	}
+	if r := s.ruleFor(key); r != nil {
+		return r.def
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// SelectOptions controls a weighted draw over the children of a prefix.
+// Each child is a candidate with a name and a weight read from its subkeys;
+// children without a name or with a weight of zero or less are skipped.
+type SelectOptions struct {
+	Count  int  // picks to make; 0 makes one
+	Unique bool // draw without replacement; fewer picks come back if candidates run out
+
+	NameKey   string // child subkey holding the name, "name" if empty
+	WeightKey string // child subkey holding the weight, "chance" if empty
+
+	// Modifiers are keys whose values multiply each candidate's weight, such
+	// as "player.luck" or "{child}.luck_bonus" where {child} is replaced by
+	// the candidate's key. Ints, floats and formulas apply; keys holding
+	// anything else are ignored, so a modifier may be left unset.
+	Modifiers []string
+
+	// Rand is the source of the draw. Nil uses the store's generator, which
+	// Seed makes reproducible.
+	Rand *rand.Rand
+}
+
+type candidate struct {
+	name   string
+	weight float64
+}
+
+// Seed restarts the store's random generator from seed
+func (s *Store) Seed(seed int64) {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
+// Select draws names from the children of prefix by weight. Candidates are
+// taken in key order, so a seeded source always gives the same picks for
+// the same data.
+func (s *Store) Select(prefix string, opts SelectOptions) []string {
+	pool := s.candidates(prefix, opts)
+	count := opts.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	if opts.Rand == nil {
+		s.rngMu.Lock()
+		defer s.rngMu.Unlock()
+		return draw(pool, count, opts.Unique, s.rng)
+	}
+	return draw(pool, count, opts.Unique, opts.Rand)
+}
+
+// candidates reads the weighted children of prefix
+func (s *Store) candidates(prefix string, opts SelectOptions) []candidate {
+	nameKey, weightKey := opts.NameKey, opts.WeightKey
+	if nameKey == "" {
+		nameKey = "name"
+	}
+	if weightKey == "" {
+		weightKey = "chance"
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pool []candidate
+	for _, child := range s.childKeys(prefix) {
+		name := s.getString(child + "." + nameKey)
+		weight, ok := s.number(child + "." + weightKey)
+		if name == "" || !ok {
+			continue
+		}
+		for _, mod := range opts.Modifiers {
+			if m, ok := s.number(strings.ReplaceAll(mod, "{child}", child)); ok {
+				weight *= m
+			}
+		}
+		if weight > 0 {
+			pool = append(pool, candidate{name: name, weight: weight})
+		}
+	}
+	return pool
+}
+
+// number reads an int, float or formula as a float; s.mu must be held
+func (s *Store) number(key string) (float64, bool) {
+	e := s.lookup(key)
+	if e == nil {
+		return 0, false
+	}
+	switch e.Type {
+	case IntType:
+		return float64(e.Value.(int64)), true
+	case FloatType:
+		return e.Value.(float64), true
+	case FormulaType:
+		return s.evalFormula(key), true
+	}
+	return 0, false
+}
+
+// draw picks count names by weight from pool
+func draw(pool []candidate, count int, unique bool, rng *rand.Rand) []string {
+	pool = append([]candidate(nil), pool...)
+	var picks []string
+	for len(picks) < count && len(pool) > 0 {
+		var total float64
+		for _, c := range pool {
+			total += c.weight
+		}
+		roll := rng.Float64() * total
+
+		i := len(pool) - 1 // rounding can leave roll at the very end
+		var cumulative float64
+		for j, c := range pool {
+			cumulative += c.weight
+			if roll < cumulative {
+				i = j
+				break
+			}
+		}
+		picks = append(picks, pool[i].name)
+		if unique {
+			pool = append(pool[:i], pool[i+1:]...)
+		}
+	}
+	return picks
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +21,9 @@ const (
 	FloatType
 	BoolType
 	StringType
+	StringListType
+	IntListType
+	FormulaType
 )
 
 type DrawItem struct {
@@ -33,10 +37,15 @@ type StoreEntry struct {
 }
 
 type GroupedStore struct {
-    Strings map[string]string  `json:"strings"`
-    Ints    map[string]int64   `json:"ints"`
-    Floats  map[string]float64 `json:"floats"`
-    Bools   map[string]bool    `json:"bools"`
+    Strings     map[string]string   `json:"strings"`
+    Ints        map[string]int64    `json:"ints"`
+    Floats      map[string]float64  `json:"floats"`
+    Bools       map[string]bool     `json:"bools"`
+    StringLists map[string][]string `json:"string_lists,omitempty"`
+    IntLists    map[string][]int64  `json:"int_lists,omitempty"`
+    Formulas    map[string]string   `json:"formulas,omitempty"`
+    TTLs        map[string]float64  `json:"ttls,omitempty"` // game time left before each key expires
+    Checkpoints map[string]savedCheckpoint `json:"checkpoints,omitempty"`
 }
 
 type node struct {
@@ -53,6 +62,14 @@ type Store struct {
 	mu   sync.RWMutex
 	root *node
 	rng *rand.Rand
+	rngMu sync.Mutex // guards rng, which readers share
+
+	watch    watchState
+	formulas formulaState
+	clock    clockState
+
+	checkpoints map[string]*checkpoint
+	schema      []*schemaRule
 }
 
 // GetStore returns the singleton Store instance, creating it if needed
@@ -107,114 +124,162 @@ func (s *Store) getNode(key string) *node {
 }
 
 // ---- Setters ----
-func (s *Store) SetInt(key string, val int64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	n := s.getOrCreateNode(key)
-	n.entry = &StoreEntry{Type: IntType, Value: val}
+// Setters fail only when the write breaks the store's schema
+func (s *Store) SetInt(key string, val int64) error {
+	return s.setEntry(key, StoreEntry{Type: IntType, Value: val})
 }
 
-func (s *Store) SetFloat(key string, val float64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	n := s.getOrCreateNode(key)
-	n.entry = &StoreEntry{Type: FloatType, Value: math.Round(val*100) / 100}
+func (s *Store) SetFloat(key string, val float64) error {
+	return s.setEntry(key, StoreEntry{Type: FloatType, Value: math.Round(val*100) / 100})
 }
 
-func (s *Store) SetBool(key string, val bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	n := s.getOrCreateNode(key)
-	n.entry = &StoreEntry{Type: BoolType, Value: val}
+func (s *Store) SetBool(key string, val bool) error {
+	return s.setEntry(key, StoreEntry{Type: BoolType, Value: val})
+}
+
+func (s *Store) SetString(key, val string) error {
+	return s.setEntry(key, StoreEntry{Type: StringType, Value: val})
 }
 
-func (s *Store) SetString(key, val string) {
+// setEntry stores e under key and notifies watchers of the change
+func (s *Store) setEntry(key string, e StoreEntry) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.applySchema(key, &e); err != nil {
+		s.mu.Unlock()
+		return err
+	}
 	n := s.getOrCreateNode(key)
-	n.entry = &StoreEntry{Type: StringType, Value: val}
+	old := n.entry
+	n.entry = &e
+	s.invalidate(key)
+	s.mu.Unlock()
+
+	if old != nil && sameEntry(*old, e) {
+		return nil
+	}
+	s.notify([]Change{newChange(key, old, &e)})
+	return nil
 }
 
 // ---- Getters ----
 func (s *Store) GetInt(key string) int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	n := s.getNode(key)
-	if  n != nil && n.entry != nil && n.entry.Type == IntType {
-		return n.entry.Value.(int64)
-	}
-	return 0
+	return s.getInt(key)
 }
 
 func (s *Store) GetFloat(key string) float64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if n := s.getNode(key); n != nil && n.entry != nil && n.entry.Type == FloatType {
-		return n.entry.Value.(float64)
-	}
-	return 0
+	return s.getFloat(key)
 }
 
-func (s *Store) GetBool(key string) bool {
+// GetNumber returns an int, float or formula as a float and reports whether
+// key holds a number
+func (s *Store) GetNumber(key string) (float64, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if n := s.getNode(key); n != nil && n.entry != nil && n.entry.Type == BoolType {
-		return n.entry.Value.(bool)
-	}
-	return false
+	return s.number(key)
 }
 
-func (s *Store) ReleaseBool(key string) bool {
+func (s *Store) GetBool(key string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if n := s.getNode(key); n != nil && n.entry != nil && n.entry.Type == BoolType{
-		if n.entry.Value.(bool) {
-			n.entry.Value = false
-			return true
+	return s.getBool(key)
+}
+
+// ReleaseBool sets a true bool to false and reports whether it did. The
+// error tells a refused write from a bool that wasn't true.
+func (s *Store) ReleaseBool(key string) (bool, error) {
+	released := false
+	err := s.Update(func(tx *Tx) error {
+		if tx.GetBool(key) {
+			released = true
+			return tx.SetBool(key, false)
 		}
-	}
-	return false
+		return nil
+	})
+	return released && err == nil, err
 }
 
 func (s *Store) GetString(key string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if n := s.getNode(key); n != nil && n.entry != nil && n.entry.Type == StringType {
-		return n.entry.Value.(string)
+	return s.getString(key)
+}
+
+// getInt and the other typed readers expect s.mu to be held. Missing keys
+// read as their schema default. Formulas read as ints are truncated toward
+// zero.
+func (s *Store) getInt(key string) int64 {
+	if e := s.lookup(key); e != nil {
+		switch e.Type {
+		case IntType:
+			return e.Value.(int64)
+		case FormulaType:
+			return int64(s.evalFormula(key))
+		}
 	}
-	return ""
+	return 0
+}
+
+func (s *Store) getFloat(key string) float64 {
+	if e := s.lookup(key); e != nil {
+		switch e.Type {
+		case FloatType:
+			return e.Value.(float64)
+		case FormulaType:
+			return s.evalFormula(key)
+		}
+	}
+	return 0
 }
 
-func (s *Store) AddInt(key string, val int64) {
-	current := s.GetInt(key)
-	s.SetInt(key, current+val)
+func (s *Store) getBool(key string) bool {
+	if e := s.lookup(key); e != nil && e.Type == BoolType {
+		return e.Value.(bool)
+	}
+	return false
 }
 
-func (s *Store) SubInt(key string, val int64) bool {
-	current := s.GetInt(key)
-	if current < val {
-		return false
+func (s *Store) getString(key string) string {
+	if e := s.lookup(key); e != nil && e.Type == StringType {
+		return e.Value.(string)
 	}
-	s.SetInt(key, current-val)
-	return true
+	return ""
 }
 
-func (s *Store) AddFloat(key string, val float64) {
-	current := s.GetFloat(key)
-	s.SetFloat(key, current+val)
+// ---- Atomic arithmetic ----
+func (s *Store) AddInt(key string, val int64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.AddInt(key, val)
+	})
 }
 
-func (s *Store) SubFloat(key string, val float64) bool {
-	current := s.GetFloat(key)
-	if current < val {
-		return false
-	}
-	s.SetFloat(key, current-val)
-	return true
+// SubInt subtracts val, returning ErrInsufficient if the current value is
+// less than val
+func (s *Store) SubInt(key string, val int64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.subInt(key, val)
+	})
 }
 
+func (s *Store) AddFloat(key string, val float64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.AddFloat(key, val)
+	})
+}
 
-// Keys returns all direct children keys under the given prefix.
+// SubFloat subtracts val, returning ErrInsufficient if the current value is
+// less than val
+func (s *Store) SubFloat(key string, val float64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.subFloat(key, val)
+	})
+}
+
+
+// Keys returns all direct children keys under the given prefix, sorted.
 // If prefix is empty, it returns top-level keys.
 func (s *Store) Keys(prefix string) []string {
     s.mu.RLock()
@@ -236,14 +301,21 @@ func (s *Store) Keys(prefix string) []string {
     for k := range cur.children {
         keys = append(keys, k)
     }
+    sort.Strings(keys)
     return keys
 }
 
 
+// FullKeys returns the full keys of the direct children of prefix, sorted
 func (s *Store) FullKeys(prefix string) []string {
     s.mu.RLock()
     defer s.mu.RUnlock()
+    return s.childKeys(prefix)
+}
 
+// childKeys returns the full keys of the direct children of prefix, sorted;
+// s.mu must be held
+func (s *Store) childKeys(prefix string) []string {
     cur := s.root
     if prefix != "" {
         parts := strings.Split(prefix, ".")
@@ -265,18 +337,37 @@ func (s *Store) FullKeys(prefix string) []string {
 			keys = append(keys, k)
 		}
     }
+    sort.Strings(keys)
     return keys
 }
 
 // Clear removes all keys (and their subkeys) under the given prefix
 func (s *Store) Clear(prefix string) {
+	s.notify(s.clear(prefix))
+}
+
+func (s *Store) clear(prefix string) []Change {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	removed := s.removeSubtree(prefix)
+	if len(removed) == 0 {
+		return nil
+	}
+	s.clock.forget(removed)
+	s.invalidateAll()
+	return diffEntries(removed, nil)
+}
+
+// removeSubtree deletes prefix and its subkeys, or everything for an empty
+// prefix, and returns the removed entries; s.mu must be held
+func (s *Store) removeSubtree(prefix string) map[string]StoreEntry {
+	removed := make(map[string]StoreEntry)
 	if prefix == "" {
 		// clear everything
+		flatten("", s.root, removed)
 		s.root = &node{children: make(map[string]*node)}
-		return
+		return removed
 	}
 
 	parts := strings.Split(prefix, ".")
@@ -284,49 +375,30 @@ func (s *Store) Clear(prefix string) {
 	for i := 0; i < len(parts)-1; i++ {
 		next := cur.children[parts[i]]
 		if next == nil {
-			return // prefix doesn't exist
+			return removed // prefix doesn't exist
 		}
 		cur = next
 	}
 
 	// delete the last part
+	last := cur.children[parts[len(parts)-1]]
+	if last == nil {
+		return removed
+	}
+	flatten(prefix, last, removed)
 	delete(cur.children, parts[len(parts)-1])
+	return removed
 }
 
 
+// RandomSelect draws the name of one child of prefix, weighted by its
+// chance; see Select for more control
 func (s *Store) RandomSelect(prefix string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	children := s.FullKeys(prefix)
-
-	var items []DrawItem
-	var total int64
-
-	for _, child := range children {
-		name := s.GetString(child + ".name")
-		chance := s.GetInt(child + ".chance")
-		if name != "" && chance > 0 {
-			items = append(items, DrawItem{Name: name, Chance: chance})
-			total += chance
-		}
-	}
-
-	if total == 0 || len(items) == 0 {
+	picks := s.Select(prefix, SelectOptions{})
+	if len(picks) == 0 {
 		return ""
 	}
-
-	roll := s.rng.Int63n(total)
-
-	var cumulative int64
-	for _, item := range items {
-		cumulative += item.Chance
-		if roll < cumulative {
-			return item.Name
-		}
-	}
-
-	return ""
+	return picks[0]
 }
 
 
@@ -350,39 +422,34 @@ func (s *Store) Save() (any, error) {
     s.mu.RLock()
     defer s.mu.RUnlock()
 
-    grouped := GroupedStore{
-        Strings: make(map[string]string),
-        Ints:    make(map[string]int64),
-        Floats:  make(map[string]float64),
-        Bools:   make(map[string]bool),
-    }
+    grouped := newGroupedStore()
 
     // traverse trie and group by type
     s.traverseAndGroup(s.root, "", &grouped)
+    for k, at := range s.clock.expiry {
+        grouped.TTLs[k] = at - s.clock.now
+    }
+    grouped.Checkpoints = s.savedCheckpoints()
 
 	return grouped, nil
 }
 
+func newGroupedStore() GroupedStore {
+    return GroupedStore{
+        Strings:     make(map[string]string),
+        Ints:        make(map[string]int64),
+        Floats:      make(map[string]float64),
+        Bools:       make(map[string]bool),
+        StringLists: make(map[string][]string),
+        IntLists:    make(map[string][]int64),
+        Formulas:    make(map[string]string),
+        TTLs:        make(map[string]float64),
+    }
+}
+
 func (s *Store) traverseAndGroup(n *node, prefix string, grouped *GroupedStore) {
     if n.entry != nil {
-        switch n.entry.Type {
-        case StringType:
-            if v, ok := n.entry.Value.(string); ok {
-                grouped.Strings[prefix] = v
-            }
-        case IntType:
-            if v, ok := n.entry.Value.(int64); ok {
-                grouped.Ints[prefix] = v
-            }
-        case FloatType:
-            if v, ok := n.entry.Value.(float64); ok {
-                grouped.Floats[prefix] = v
-            }
-        case BoolType:
-            if v, ok := n.entry.Value.(bool); ok {
-                grouped.Bools[prefix] = v
-            }
-        }
+        grouped.add(prefix, *n.entry)
     }
 
     for key, child := range n.children {
@@ -395,7 +462,77 @@ func (s *Store) traverseAndGroup(n *node, prefix string, grouped *GroupedStore)
     }
 }
 
+// add files e under key in the map for its type
+func (grouped *GroupedStore) add(key string, e StoreEntry) {
+    switch e.Type {
+    case StringType:
+        if v, ok := e.Value.(string); ok {
+            grouped.Strings[key] = v
+        }
+    case IntType:
+        if v, ok := e.Value.(int64); ok {
+            grouped.Ints[key] = v
+        }
+    case FloatType:
+        if v, ok := e.Value.(float64); ok {
+            grouped.Floats[key] = v
+        }
+    case BoolType:
+        if v, ok := e.Value.(bool); ok {
+            grouped.Bools[key] = v
+        }
+    case StringListType:
+        if v, ok := e.Value.([]string); ok {
+            grouped.StringLists[key] = append([]string{}, v...)
+        }
+    case IntListType:
+        if v, ok := e.Value.([]int64); ok {
+            grouped.IntLists[key] = append([]int64{}, v...)
+        }
+    case FormulaType:
+        if v, ok := e.Value.(string); ok {
+            grouped.Formulas[key] = v
+        }
+    }
+}
+
+// entries returns the grouped values as typed entries by key
+func (grouped *GroupedStore) entries() map[string]StoreEntry {
+    out := make(map[string]StoreEntry)
+    for k, v := range grouped.Strings {
+        out[k] = StoreEntry{Type: StringType, Value: v}
+    }
+    for k, v := range grouped.Ints {
+        out[k] = StoreEntry{Type: IntType, Value: v}
+    }
+    for k, v := range grouped.Floats {
+        out[k] = StoreEntry{Type: FloatType, Value: math.Round(v*100) / 100}
+    }
+    for k, v := range grouped.Bools {
+        out[k] = StoreEntry{Type: BoolType, Value: v}
+    }
+    for k, v := range grouped.StringLists {
+        out[k] = StoreEntry{Type: StringListType, Value: append([]string{}, v...)}
+    }
+    for k, v := range grouped.IntLists {
+        out[k] = StoreEntry{Type: IntListType, Value: append([]int64{}, v...)}
+    }
+    for k, v := range grouped.Formulas {
+        out[k] = StoreEntry{Type: FormulaType, Value: v}
+    }
+    return out
+}
+
+// Load replaces the store's contents, including its checkpoints. Formulas
+// that don't parse or depend on themselves are still loaded, read as 0 and
+// reported in the returned error.
 func (s *Store) Load(data json.RawMessage) error {
+    changes, err := s.load(data)
+    s.notify(changes)
+    return err
+}
+
+func (s *Store) load(data json.RawMessage) ([]Change, error) {
     s.mu.Lock()
     defer s.mu.Unlock()
 
@@ -407,49 +544,38 @@ func (s *Store) Load(data json.RawMessage) error {
     }
 
     if err := json.Unmarshal(data, &grouped); err != nil {
-        return err
+        return nil, err
     }
 
-    // reset root
-    s.root = &node{children: make(map[string]*node)}
+    before := make(map[string]StoreEntry)
+    flatten("", s.root, before)
 
-    // rebuild trie from strings
-    for k, v := range grouped.Strings {
-        n := s.getOrCreateNode(k)
-        n.entry = &StoreEntry{
-            Type:  StringType,
-            Value: v,
-        }
+    // reset root and rebuild the trie
+    s.root = &node{children: make(map[string]*node)}
+    after := grouped.entries()
+    for k, e := range after {
+        e := e
+        s.getOrCreateNode(k).entry = &e
     }
+    s.invalidateAll()
 
-    // rebuild trie from ints
-    for k, v := range grouped.Ints {
-        n := s.getOrCreateNode(k)
-        n.entry = &StoreEntry{
-            Type:  IntType,
-            Value: v,
-        }
-    }
+    // restore expiry times relative to the current game clock
+    s.clock.expiry = nil
+    s.restoreTTLs(grouped.TTLs)
 
-    // rebuild trie from floats
-    for k, v := range grouped.Floats {
-        n := s.getOrCreateNode(k)
-        n.entry = &StoreEntry{
-            Type:  FloatType,
-            Value: math.Round(v*100) / 100,
-        }
-    }
+    s.loadCheckpoints(grouped.Checkpoints)
+    return diffEntries(before, after), s.validateFormulas(grouped.Formulas)
+}
 
-    // rebuild trie from bools
-    for k, v := range grouped.Bools {
-        n := s.getOrCreateNode(k)
-        n.entry = &StoreEntry{
-            Type:  BoolType,
-            Value: v,
+// restoreTTLs gives each existing key in ttls the time left it names; s.mu
+// must be held
+func (s *Store) restoreTTLs(ttls map[string]float64) {
+    for k, left := range ttls {
+        if n := s.getNode(k); n != nil && n.entry != nil && left > 0 {
+            at := s.clock.now + left
+            s.clock.setExpiry(k, &at)
         }
     }
-
-    return nil
 }
 
 func (s *Store) LoadFromText(text string) error {
@@ -1,9 +1,12 @@
 package store
 
 import (
+	"errors"
 	"os"
+	"sync"
 	"testing"
 	"fmt"
+	"math/rand"
 	"github.com/stretchr/testify/assert"
 	"encoding/json"
 )
@@ -465,18 +468,24 @@ func TestStoreReleaseBool(t *testing.T) {
 
 	// Case 1: value exists and is true
 	s.SetBool("quest.completed", true)
-	assert.True(t, s.ReleaseBool("quest.completed"), "should return true when releasing true value")
+	released, err := s.ReleaseBool("quest.completed")
+	assert.NoError(t, err)
+	assert.True(t, released, "should return true when releasing true value")
 	assert.False(t, s.GetBool("quest.completed"), "value should be reset to false after release")
 
 	// Case 2: value exists but already false
-	assert.False(t, s.ReleaseBool("quest.completed"), "should return false when value is already false")
+	released, err = s.ReleaseBool("quest.completed")
+	assert.NoError(t, err)
+	assert.False(t, released, "should return false when value is already false")
 
 	// Case 3: key does not exist
-	assert.False(t, s.ReleaseBool("quest.missing"), "should return false for non-existent key")
+	released, _ = s.ReleaseBool("quest.missing")
+	assert.False(t, released, "should return false for non-existent key")
 
 	// Case 4: wrong type (int instead of bool)
 	s.SetInt("quest.level", 5)
-	assert.False(t, s.ReleaseBool("quest.level"), "should return false for type mismatch")
+	released, _ = s.ReleaseBool("quest.level")
+	assert.False(t, released, "should return false for type mismatch")
 }
 
 // Test for the new SaveGrouped method
@@ -507,4 +516,669 @@ func TestSaveGrouped(t *testing.T) {
 	assert.Equal(t, false, s2.GetBool("quest.completed"))
 	assert.Equal(t, "TestPlayer", s2.GetString("player.name"))
 	assert.Equal(t, int64(7), s2.GetInt("player.progress.level"))
-}
\ No newline at end of file
+}
+
+func TestWatchAndChangeQueue(t *testing.T) {
+	s := NewStore()
+	s.SetInt("player.stats.hp", 10)
+
+	var changes []Change
+	id := s.Watch("player.stats", func(c Change) {
+		// Watchers run outside the lock and may read the store
+		s.GetInt(c.Key)
+		changes = append(changes, c)
+	})
+
+	s.SetInt("player.stats.hp", 12)
+	s.AddInt("player.stats.hp", 3)
+	s.SetInt("player.stats.hp", 15) // unchanged, not reported
+	s.SetString("player.name", "kaori")
+	s.SetInt("player.statsx", 1)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "player.stats.hp", changes[0].Key)
+	assert.Equal(t, int64(10), changes[0].Old.Value)
+	assert.Equal(t, int64(12), changes[0].New.Value)
+	assert.Equal(t, int64(15), changes[1].New.Value)
+
+	// Clear reports removed keys with no new value
+	changes = nil
+	s.SetBool("player.stats.dead", false)
+	s.Clear("player.stats")
+	assert.Len(t, changes, 3)
+	assert.Equal(t, "player.stats.dead", changes[1].Key)
+	assert.Nil(t, changes[2].New)
+
+	// Load reports the difference between the old and new contents
+	changes = nil
+	s.SetInt("player.stats.hp", 1)
+	changes = nil
+	assert.NoError(t, s.LoadFromText(`{"ints":{"player.stats.hp":1,"player.stats.mp":5}}`))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "player.stats.mp", changes[0].Key)
+	assert.Nil(t, changes[0].Old)
+
+	assert.True(t, s.Unwatch(id))
+	assert.False(t, s.Unwatch(id))
+	s.SetInt("player.stats.hp", 99)
+	assert.Len(t, changes, 1)
+
+	sub := s.Subscribe("currency")
+	s.SetInt("currency.gold", 5)
+	assert.NoError(t, s.SubInt("currency.gold", 2))
+	s.SetInt("other", 1)
+	c, ok := s.PollChange(sub)
+	assert.True(t, ok)
+	assert.Equal(t, "currency.gold", c.Key)
+	c, ok = s.PollChange(sub)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), c.New.Value)
+	_, ok = s.PollChange(sub)
+	assert.False(t, ok)
+
+	for i := 0; i < maxQueuedChanges+10; i++ {
+		s.SetInt("currency.gold", int64(i))
+	}
+	c, _ = s.PollChange(sub)
+	assert.Equal(t, int64(10), c.New.Value)
+	assert.True(t, s.Unwatch(sub))
+}
+
+func TestSubscribeWhileWriting(t *testing.T) {
+	s := NewStore()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(0); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				s.SetInt("currency.gold", i)
+			}
+		}
+	}()
+
+	// Every subscription sees the first write made after it exists
+	for i := 0; i < 50; i++ {
+		sub := s.Subscribe("currency")
+		s.SetInt("currency.gems", int64(i+1))
+		found := false
+		for {
+			c, ok := s.PollChange(sub)
+			if !ok {
+				break
+			}
+			if c.Key == "currency.gems" {
+				found = true
+				assert.Equal(t, int64(i+1), c.New.Value)
+				if i > 0 {
+					assert.Equal(t, int64(i), c.Old.Value)
+				}
+			}
+		}
+		assert.True(t, found)
+		s.Unwatch(sub)
+	}
+	close(stop)
+	<-done
+}
+
+func TestAtomicArithmetic(t *testing.T) {
+	s := NewStore()
+	s.SetInt("gold", 0)
+	s.SetFloat("mana", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.AddInt("gold", 1)
+				s.AddFloat("mana", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1000), s.GetInt("gold"))
+	assert.Equal(t, 1000.0, s.GetFloat("mana"))
+
+	// Concurrent spends never take more than there is
+	spent := int64(0)
+	var mu sync.Mutex
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.SubInt("gold", 30) == nil {
+				mu.Lock()
+				spent += 30
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(990), spent)
+	assert.Equal(t, int64(10), s.GetInt("gold"))
+}
+
+func TestUpdateTransaction(t *testing.T) {
+	s := NewStore()
+	s.SetInt("currency.gold", 60)
+	s.SetInt("currency.gems", 1)
+
+	var changes []Change
+	s.Watch("currency", func(c Change) { changes = append(changes, c) })
+
+	spend := func(tx *Tx) error {
+		if !tx.SubInt("currency.gold", 50) || !tx.SubInt("currency.gems", 2) {
+			return ErrInsufficient
+		}
+		tx.SetBool("currency.bought", true)
+		return nil
+	}
+
+	// Not enough gems: the gold is refunded and nothing is reported
+	assert.ErrorIs(t, s.Update(spend), ErrInsufficient)
+	assert.Equal(t, int64(60), s.GetInt("currency.gold"))
+	assert.Empty(t, changes)
+
+	s.SetInt("currency.gems", 5)
+	changes = nil
+	assert.NoError(t, s.Update(spend))
+	assert.Equal(t, int64(10), s.GetInt("currency.gold"))
+	assert.Equal(t, int64(3), s.GetInt("currency.gems"))
+	assert.Len(t, changes, 3)
+	assert.Equal(t, "currency.bought", changes[0].Key)
+
+	// Keys created by a failed transaction are removed again
+	err := s.Update(func(tx *Tx) error {
+		tx.SetString("tmp.a.b", "x")
+		return errors.New("abort")
+	})
+	assert.Error(t, err)
+	assert.Empty(t, s.Keys("tmp"))
+	assert.NotContains(t, s.Keys(""), "tmp")
+
+	// A panic rolls back too
+	assert.Panics(t, func() {
+		s.Update(func(tx *Tx) error {
+			tx.SetInt("currency.gold", 0)
+			panic("boom")
+		})
+	})
+	assert.Equal(t, int64(10), s.GetInt("currency.gold"))
+}
+
+func TestReleaseBoolNotifies(t *testing.T) {
+	s := NewStore()
+	s.SetBool("event.ready", true)
+	sub := s.Subscribe("event")
+	released, err := s.ReleaseBool("event.ready")
+	assert.True(t, released)
+	assert.NoError(t, err)
+	released, _ = s.ReleaseBool("event.ready")
+	assert.False(t, released)
+	c, ok := s.PollChange(sub)
+	assert.True(t, ok)
+	assert.Equal(t, false, c.New.Value)
+	_, ok = s.PollChange(sub)
+	assert.False(t, ok)
+}
+
+func TestListValues(t *testing.T) {
+	s := NewStore()
+
+	s.AppendString("unlocked.maps", "forest")
+	s.AppendString("unlocked.maps", "desert")
+	s.AppendString("unlocked.maps", "forest")
+	assert.Equal(t, []string{"forest", "desert", "forest"}, s.GetStringList("unlocked.maps"))
+	assert.True(t, s.ContainsString("unlocked.maps", "desert"))
+	removed, err := s.RemoveString("unlocked.maps", "forest")
+	assert.True(t, removed)
+	assert.NoError(t, err)
+	removed, err = s.RemoveString("unlocked.maps", "tundra")
+	assert.False(t, removed)
+	assert.NoError(t, err, "a missing value isn't an error")
+	assert.Equal(t, []string{"desert", "forest"}, s.GetStringList("unlocked.maps"))
+	assert.Equal(t, 2, s.ListLen("unlocked.maps"))
+
+	s.SetIntList("owned.skins", []int64{3, 7})
+	s.AppendInt("owned.skins", 9)
+	removed, err = s.RemoveInt("owned.skins", 7)
+	assert.True(t, removed)
+	assert.NoError(t, err)
+	assert.True(t, s.ContainsInt("owned.skins", 9))
+	assert.False(t, s.ContainsInt("owned.skins", 7))
+	assert.Equal(t, 2, s.ListLen("owned.skins"))
+	assert.Equal(t, 0, s.ListLen("missing"))
+
+	// Returned lists are copies
+	list := s.GetStringList("unlocked.maps")
+	list[0] = "changed"
+	assert.Equal(t, "desert", s.GetStringList("unlocked.maps")[0])
+
+	// Appending replaces a value of another type
+	s.SetInt("count", 1)
+	s.AppendInt("count", 5)
+	assert.Equal(t, []int64{5}, s.GetIntList("count"))
+	assert.Equal(t, int64(0), s.GetInt("count"))
+
+	var changes []Change
+	s.Watch("owned", func(c Change) { changes = append(changes, c) })
+	s.AppendInt("owned.skins", 11)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, []int64{3, 9}, changes[0].Old.Value)
+	assert.Equal(t, []int64{3, 9, 11}, changes[0].New.Value)
+
+	data, err := s.Save()
+	assert.NoError(t, err)
+	raw, _ := json.Marshal(data)
+	s2 := NewStore()
+	assert.NoError(t, s2.Load(raw))
+	assert.Equal(t, []string{"desert", "forest"}, s2.GetStringList("unlocked.maps"))
+	assert.Equal(t, []int64{3, 9, 11}, s2.GetIntList("owned.skins"))
+
+	// Old saves without list sections still load
+	assert.NoError(t, s2.LoadFromText(`{"ints":{"a":1}}`))
+	assert.Equal(t, 0, s2.ListLen("owned.skins"))
+
+	h := OpenIter(s.GetStringList("unlocked.maps"))
+	assert.Equal(t, "desert", IterNext(h))
+	assert.Equal(t, "forest", IterNext(h))
+	assert.Equal(t, "", IterNext(h))
+	CloseIter(h)
+	ih := OpenIntIter(s.GetIntList("owned.skins"))
+	v, ok := IntIterNext(ih)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), v)
+	CloseIntIter(ih)
+}
+
+func TestFormulaKeys(t *testing.T) {
+	s := NewStore()
+	s.SetInt("player.base_damage", 10)
+	s.SetFloat("player.damage_bonus", 0.5)
+	assert.NoError(t, s.SetFormula("player.damage", "player.base_damage * (1 + player.damage_bonus)"))
+	assert.NoError(t, s.SetFormula("player.crit", "max(player.damage * 2, 25) - -1"))
+
+	assert.Equal(t, 15.0, s.GetFloat("player.damage"))
+	assert.Equal(t, int64(15), s.GetInt("player.damage"))
+	assert.Equal(t, 31.0, s.GetFloat("player.crit"))
+	assert.Equal(t, []string{"player.base_damage", "player.damage_bonus"}, s.Dependencies("player.damage"))
+	for key, want := range map[string]float64{"player.damage": 15, "player.base_damage": 10, "player.damage_bonus": 0.5} {
+		v, ok := s.GetNumber(key)
+		assert.True(t, ok)
+		assert.Equal(t, want, v, key)
+	}
+	_, ok := s.GetNumber("player.missing")
+	assert.False(t, ok)
+
+	// Cached results follow their dependencies, including through other formulas
+	s.SetInt("player.base_damage", 20)
+	assert.Equal(t, 30.0, s.GetFloat("player.damage"))
+	assert.Equal(t, 61.0, s.GetFloat("player.crit"))
+	s.AddFloat("player.damage_bonus", 0.25)
+	assert.Equal(t, 35.0, s.GetFloat("player.damage"))
+	assert.Error(t, s.Update(func(tx *Tx) error {
+		tx.SetInt("player.base_damage", 4)
+		assert.Equal(t, 7.0, tx.GetFloat("player.damage"))
+		return errors.New("abort")
+	}))
+	assert.Equal(t, 35.0, s.GetFloat("player.damage"))
+	s.Clear("player.damage_bonus")
+	assert.Equal(t, 20.0, s.GetFloat("player.damage"))
+
+	// Missing keys read as 0, division by zero yields 0
+	assert.NoError(t, s.SetFormula("ratio", "player.base_damage / missing"))
+	assert.Equal(t, 0.0, s.GetFloat("ratio"))
+
+	// Bad expressions and cycles are rejected and leave the old value
+	assert.Error(t, s.SetFormula("bad", "1 +"))
+	assert.Error(t, s.SetFormula("bad", "nope(1)"))
+	assert.Error(t, s.SetFormula("bad", "(1"))
+	assert.Equal(t, "", s.GetFormula("bad"))
+	err := s.SetFormula("player.base_damage", "player.crit / 2")
+	assert.ErrorIs(t, err, ErrFormulaCycle)
+	assert.ErrorIs(t, s.SetFormula("self", "self + 1"), ErrFormulaCycle)
+	assert.Equal(t, int64(20), s.GetInt("player.base_damage"))
+
+	// Formulas round-trip through saves and can be authored in config JSON
+	data, err := s.Save()
+	assert.NoError(t, err)
+	raw, _ := json.Marshal(data)
+	s2 := NewStore()
+	assert.NoError(t, s2.Load(raw))
+	assert.Equal(t, "player.base_damage * (1 + player.damage_bonus)", s2.GetFormula("player.damage"))
+	assert.Equal(t, 20.0, s2.GetFloat("player.damage"))
+
+	err = s2.LoadFromText(`{"ints":{"hp":50},"formulas":{"half":"hp / 2","a":"b","b":"a","broken":"hp *"}}`)
+	assert.Error(t, err)
+	assert.Equal(t, 25.0, s2.GetFloat("half"))
+	assert.Equal(t, 0.0, s2.GetFloat("a"))
+	assert.Equal(t, 0.0, s2.GetFloat("broken"))
+}
+
+func TestExpiringKeys(t *testing.T) {
+	s := NewStore()
+	assert.NoError(t, s.SetWithTTL("buffs.haste", true, 5))
+	assert.NoError(t, s.SetWithTTL("cooldowns.dash", 1.5, 2))
+	s.SetInt("gold", 10)
+	assert.ErrorIs(t, s.SetWithTTL("bad", true, 0), ErrInvalidTTL)
+	assert.Error(t, s.SetWithTTL("bad", []int{1}, 1))
+	assert.Equal(t, 0, len(s.Keys("bad")))
+
+	var removed []string
+	s.Watch("", func(c Change) {
+		if c.New == nil {
+			removed = append(removed, c.Key)
+		}
+	})
+
+	assert.Empty(t, s.Advance(1))
+	left, ok := s.TTL("buffs.haste")
+	assert.True(t, ok)
+	assert.Equal(t, 4.0, left)
+	_, ok = s.TTL("gold")
+	assert.False(t, ok)
+
+	// Paused clocks don't expire anything
+	s.SetPaused(true)
+	assert.Empty(t, s.Advance(10))
+	assert.True(t, s.GetBool("buffs.haste"))
+	s.SetPaused(false)
+
+	// Writes keep the TTL
+	s.SetFloat("cooldowns.dash", 0.5)
+	assert.Equal(t, []string{"cooldowns.dash"}, s.Advance(1))
+	assert.Equal(t, []string{"cooldowns.dash"}, removed)
+	assert.Equal(t, 0.0, s.GetFloat("cooldowns.dash"))
+	assert.Nil(t, s.getNode("cooldowns"))
+
+	// TTLs survive Save/Load as time left
+	data, err := s.Save()
+	assert.NoError(t, err)
+	raw, _ := json.Marshal(data)
+	s2 := NewStore()
+	assert.NoError(t, s2.Load(raw))
+	left, ok = s2.TTL("buffs.haste")
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, left)
+	assert.Empty(t, s2.Advance(2.5))
+	assert.Equal(t, []string{"buffs.haste"}, s2.Advance(0.5))
+
+	// Persist, SetTTL and rolled back transactions
+	persisted, err := s.Persist("buffs.haste")
+	assert.True(t, persisted)
+	assert.NoError(t, err)
+	persisted, _ = s.Persist("buffs.haste")
+	assert.False(t, persisted)
+	assert.ErrorIs(t, s.SetTTL("missing", 1), ErrNoKey)
+	assert.ErrorIs(t, s.SetTTL("gold", 0), ErrInvalidTTL)
+	assert.NoError(t, s.SetTTL("gold", 1))
+	assert.Error(t, s.Update(func(tx *Tx) error {
+		tx.Persist("gold")
+		assert.NoError(t, tx.SetWithTTL("temp", 1, 1))
+		return errors.New("abort")
+	}))
+	_, ok = s.TTL("gold")
+	assert.True(t, ok)
+	_, ok = s.TTL("temp")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"gold"}, s.Advance(1))
+	assert.True(t, s.GetBool("buffs.haste"))
+
+	// Clearing a key drops its TTL
+	assert.NoError(t, s.SetWithTTL("run.timer", 1, 1))
+	s.Clear("run")
+	s.SetInt("run.timer", 2)
+	assert.Empty(t, s.Advance(5))
+	assert.Equal(t, int64(2), s.GetInt("run.timer"))
+}
+
+func TestCheckpoints(t *testing.T) {
+	s := NewStore()
+	s.SetInt("run.gold", 10)
+	s.SetStringList("run.items", []string{"sword"})
+	assert.NoError(t, s.SetWithTTL("run.shield", true, 4))
+	s.SetInt("meta.unlocks", 1)
+
+	s.Checkpoint("level_start", "run.", false)
+	s.Checkpoint("everything", "", true)
+	assert.Equal(t, []string{"everything", "level_start"}, s.Checkpoints())
+	prefix, ok := s.CheckpointPrefix("level_start")
+	assert.True(t, ok)
+	assert.Equal(t, "run", prefix)
+
+	s.AddInt("run.gold", 5)
+	s.AppendString("run.items", "bow")
+	s.SetBool("run.boss_seen", true)
+	s.Advance(3)
+	s.SetInt("meta.unlocks", 2)
+
+	var changes []Change
+	s.Watch("", func(c Change) { changes = append(changes, c) })
+
+	// Retry the level: only the run prefix goes back
+	assert.True(t, s.RestoreCheckpoint("level_start"))
+	assert.Equal(t, int64(10), s.GetInt("run.gold"))
+	assert.Equal(t, []string{"sword"}, s.GetStringList("run.items"))
+	assert.False(t, s.GetBool("run.boss_seen"))
+	assert.Nil(t, s.getNode("run.boss_seen"))
+	assert.Equal(t, int64(2), s.GetInt("meta.unlocks"))
+	left, ok := s.TTL("run.shield")
+	assert.True(t, ok)
+	assert.Equal(t, 4.0, left)
+	assert.Len(t, changes, 3)
+
+	// Checkpoints can be restored again
+	s.SetInt("run.gold", 0)
+	assert.True(t, s.RestoreCheckpoint("level_start"))
+	assert.Equal(t, int64(10), s.GetInt("run.gold"))
+	assert.False(t, s.RestoreCheckpoint("missing"))
+
+	// Only persisted checkpoints are saved
+	data, err := s.Save()
+	assert.NoError(t, err)
+	raw, _ := json.Marshal(data)
+	s2 := NewStore()
+	s2.Checkpoint("scratch", "run", false)
+	s2.Checkpoint("stale", "", true)
+	assert.NoError(t, s2.Load(raw))
+	assert.Equal(t, []string{"everything", "scratch"}, s2.Checkpoints())
+	s2.Clear("")
+	assert.True(t, s2.RestoreCheckpoint("everything"))
+	assert.Equal(t, int64(1), s2.GetInt("meta.unlocks"))
+	assert.Equal(t, []string{"sword"}, s2.GetStringList("run.items"))
+	left, ok = s2.TTL("run.shield")
+	assert.True(t, ok)
+	assert.Equal(t, 4.0, left)
+
+	assert.True(t, s.DeleteCheckpoint("level_start"))
+	assert.False(t, s.DeleteCheckpoint("level_start"))
+	assert.Equal(t, []string{"everything"}, s.Checkpoints())
+}
+
+func TestQueries(t *testing.T) {
+	s := NewStore()
+	s.SetString("items.sword.slot_type", "weapon")
+	s.SetInt("items.sword.price", 120)
+	s.SetString("items.bow.slot_type", "weapon")
+	s.SetInt("items.bow.price", 80)
+	s.SetFloat("items.bow.chance", 0.5)
+	s.SetString("items.cap.slot_type", "head")
+	s.SetFloat("items.cap.price", 99.5)
+	s.SetInt("loot.tables.common.chance", 70)
+	s.SetInt("chance", 1)
+	assert.NoError(t, s.SetFormula("items.relic.price", "items.bow.price * 2"))
+
+	assert.Equal(t, []string{"items.bow.slot_type", "items.cap.slot_type", "items.sword.slot_type"},
+		s.Match("items.*.slot_type"))
+	assert.Equal(t, []string{"chance", "items.bow.chance", "loot.tables.common.chance"}, s.Match("**.chance"))
+	assert.Equal(t, []string{"items.bow.price", "items.sword.price"}, s.Match("items.[bs]*.price"))
+	assert.Empty(t, s.Match("items.*"))
+	assert.Empty(t, s.Match(""))
+
+	assert.Equal(t, []string{"items.bow.chance", "items.bow.price", "items.bow.slot_type"}, s.AllKeys("items.bow"))
+	assert.Len(t, s.AllKeys(""), 10)
+
+	below := 100.0
+	assert.Equal(t, []string{"items.bow.price", "items.cap.price"}, s.Find(Query{Pattern: "items.*.price", Max: &below}))
+	assert.Equal(t, []string{"items.relic.price", "items.sword.price"}, s.Find(Query{Pattern: "items.*.price", Min: &below}))
+	assert.Equal(t, []string{"items.bow.price", "items.sword.price"},
+		s.Find(Query{Pattern: "items.*.price", Types: []ValueType{IntType}}))
+	assert.Empty(t, s.Find(Query{Pattern: "items.*.slot_type", Min: &below}))
+
+	assert.Equal(t, []string{"bow", "cap", "relic", "sword"}, s.Keys("items"))
+	assert.Equal(t, []string{"items.bow", "items.cap", "items.relic", "items.sword"}, s.FullKeys("items"))
+}
+
+func TestWeightedSelect(t *testing.T) {
+	s := NewStore()
+	assert.NoError(t, s.LoadFromText(`{
+		"strings": {"loot.a.name": "common", "loot.b.name": "rare", "loot.c.name": "legendary", "loot.d.name": "nothing"},
+		"ints": {"loot.a.chance": 90, "loot.d.chance": 0},
+		"floats": {"loot.b.chance": 9.5, "loot.c.chance": 0.5, "loot.c.luck_bonus": 3, "player.luck": 2}
+	}`))
+
+	// Seeded draws repeat
+	opts := SelectOptions{Count: 20, Rand: rand.New(rand.NewSource(7))}
+	first := s.Select("loot", opts)
+	opts.Rand = rand.New(rand.NewSource(7))
+	assert.Equal(t, first, s.Select("loot", opts))
+	assert.Len(t, first, 20)
+	assert.NotContains(t, first, "nothing")
+
+	s.Seed(3)
+	a := s.Select("loot", SelectOptions{Count: 5})
+	s.Seed(3)
+	assert.Equal(t, a, s.Select("loot", SelectOptions{Count: 5}))
+
+	// Without replacement every candidate comes back once
+	all := s.Select("loot", SelectOptions{Count: 10, Unique: true})
+	assert.ElementsMatch(t, []string{"common", "rare", "legendary"}, all)
+
+	// Modifiers scale weights; unset ones are ignored
+	s.SetFloat("loot.a.chance", 0)
+	counts := make(map[string]int)
+	for _, name := range s.Select("loot", SelectOptions{
+		Count:     1000,
+		Modifiers: []string{"{child}.luck_bonus", "player.luck", "player.missing"},
+		Rand:      rand.New(rand.NewSource(1)),
+	}) {
+		counts[name]++
+	}
+	// rare weighs 9.5 * 2, legendary 0.5 * 3 * 2
+	assert.Greater(t, counts["legendary"], 30)
+	assert.Greater(t, counts["rare"], counts["legendary"])
+
+	// Weights may be formulas
+	assert.NoError(t, s.SetFormula("loot.a.chance", "player.luck * 1000"))
+	assert.Equal(t, "common", s.Select("loot", SelectOptions{Rand: rand.New(rand.NewSource(1))})[0])
+
+	assert.Empty(t, s.Select("missing", SelectOptions{}))
+	assert.Equal(t, "", s.RandomSelect("missing"))
+}
+
+func TestRandomSelectWithPendingWriter(t *testing.T) {
+	s := NewStore()
+	s.SetString("draw.1.name", "a")
+	s.SetInt("draw.1.chance", 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				assert.Equal(t, "a", s.RandomSelect("draw"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				s.SetInt("draw.1.chance", 1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSchema(t *testing.T) {
+	s := NewStore()
+	assert.NoError(t, s.LoadSchema([]byte(`
+keys:
+  - pattern: player.hp
+    type: int
+    default: 100
+    min: 0
+    max: 100
+  - pattern: player.speed
+    type: float
+    default: 1.5
+    min: 0.5
+  - pattern: items.*.price
+    type: int
+    read_only: true
+  - pattern: "**.tags"
+    type: string_list
+    default: [starter]
+`)))
+
+	// Missing keys read as their defaults
+	assert.Equal(t, int64(100), s.GetInt("player.hp"))
+	assert.Equal(t, 1.5, s.GetFloat("player.speed"))
+	assert.Equal(t, []string{"starter"}, s.GetStringList("player.tags"))
+	assert.NoError(t, s.SetFormula("player.hp_ratio", "player.hp / 100"))
+	assert.Equal(t, 1.0, s.GetFloat("player.hp_ratio"))
+
+	// Numbers are clamped
+	assert.NoError(t, s.SetInt("player.hp", 250))
+	assert.Equal(t, int64(100), s.GetInt("player.hp"))
+	assert.NoError(t, s.AddInt("player.hp", -130))
+	assert.Equal(t, int64(0), s.GetInt("player.hp"))
+	assert.NoError(t, s.SetFloat("player.speed", 0.1))
+	assert.Equal(t, 0.5, s.GetFloat("player.speed"))
+
+	// Wrong types and read-only keys are rejected
+	assert.ErrorIs(t, s.SetString("player.hp", "full"), ErrSchemaType)
+	assert.ErrorIs(t, s.SetFloat("player.hp", 3), ErrSchemaType)
+	assert.ErrorIs(t, s.SetInt("items.sword.price", 1), ErrReadOnly)
+	assert.ErrorIs(t, s.AppendInt("npc.tags", 1), ErrSchemaType)
+	assert.Equal(t, int64(0), s.GetInt("player.hp"))
+	assert.ErrorIs(t, s.SetTTL("items.sword.price", 1), ErrReadOnly)
+	assert.ErrorIs(t, s.SetWithTTL("items.sword.price", 1, 1), ErrReadOnly)
+	assert.NoError(t, s.SetFormula("player.hp", "50"))
+
+	// A rejected write aborts the whole transaction
+	s.SetInt("gold", 10)
+	err := s.Update(func(tx *Tx) error {
+		tx.SetInt("gold", 0)
+		tx.SetInt("items.sword.price", 0)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Equal(t, int64(10), s.GetInt("gold"))
+
+	// Loads are trusted, so configs can author read-only keys
+	assert.NoError(t, s.LoadFromText(`{"ints":{"items.sword.price":120}}`))
+	assert.Equal(t, int64(120), s.GetInt("items.sword.price"))
+	assert.ErrorIs(t, s.SubInt("items.sword.price", 20), ErrReadOnly)
+	assert.ErrorIs(t, s.SubInt("items.sword.price", 500), ErrInsufficient)
+	removed, err := s.RemoveString("items.sword.price", "x")
+	assert.False(t, removed)
+	assert.NoError(t, err, "nothing to remove, so nothing to refuse")
+
+	// JSON schemas load too, and invalid rules are reported
+	assert.NoError(t, s.LoadSchema([]byte(`{"keys":[{"pattern":"gold","type":"int","min":0}]}`)))
+	assert.NoError(t, s.SetInt("items.sword.price", 1))
+	assert.Error(t, s.LoadSchema([]byte(`keys: [{pattern: a, type: number}]`)))
+	assert.Error(t, s.LoadSchema([]byte(`keys: [{pattern: a, type: int, default: 1.5}]`)))
+	assert.Error(t, s.LoadSchema([]byte(`keys: [{pattern: a, type: int, default: 5, max: 3}]`)))
+	assert.Error(t, s.LoadSchema([]byte(`keys: [{pattern: a, type: string, min: 1}]`)))
+	assert.Error(t, s.LoadSchema([]byte(`keys: [`)))
+
+	assert.NoError(t, s.SetSchema(nil))
+	assert.NoError(t, s.SetString("gold", "lots"))
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Keys can be given a time to live on the store's game clock. The clock only
+// moves when Advance is called and stands still while paused, so buffs and
+// cooldowns don't run out behind a pause menu. Writing a key keeps its TTL;
+// SetTTL replaces it and Persist removes it. Save stores the time left, so a
+// loaded key expires as much game time later as it had left when saved.
+
+var (
+	// ErrInvalidTTL is returned when a TTL is not positive
+	ErrInvalidTTL = errors.New("store: ttl must be positive")
+	// ErrNoKey is returned when giving a TTL to a key that holds no value
+	ErrNoKey = errors.New("store: key holds no value")
+)
+
+type clockState struct {
+	now    float64
+	paused bool
+	expiry map[string]float64 // game time each expiring key is removed at
+}
+
+// setExpiry sets or, when at is nil, removes the expiry of key
+func (c *clockState) setExpiry(key string, at *float64) {
+	if at == nil {
+		delete(c.expiry, key)
+		return
+	}
+	if c.expiry == nil {
+		c.expiry = make(map[string]float64)
+	}
+	c.expiry[key] = *at
+}
+
+// forget drops the expiry of every removed key
+func (c *clockState) forget(removed map[string]StoreEntry) {
+	for key := range removed {
+		delete(c.expiry, key)
+	}
+}
+
+// ---- Tx ----
+
+// saveExpiry remembers the expiry key had before its first TTL change
+func (tx *Tx) saveExpiry(key string) {
+	if _, seen := tx.expiry[key]; seen {
+		return
+	}
+	var prev *float64
+	if at, ok := tx.s.clock.expiry[key]; ok {
+		prev = &at
+	}
+	tx.expiry[key] = prev
+}
+
+// SetTTL makes an existing key expire after ttl units of game time
+func (tx *Tx) SetTTL(key string, ttl float64) bool {
+	return tx.setTTL(key, ttl) == nil
+}
+
+// setTTL is SetTTL returning why the TTL was refused
+func (tx *Tx) setTTL(key string, ttl float64) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	if !tx.s.writable(key) {
+		return fmt.Errorf("%w: %s", ErrReadOnly, key)
+	}
+	if n := tx.s.getNode(key); n == nil || n.entry == nil {
+		return fmt.Errorf("%w: %s", ErrNoKey, key)
+	}
+	tx.saveExpiry(key)
+	at := tx.s.clock.now + ttl
+	tx.s.clock.setExpiry(key, &at)
+	return nil
+}
+
+// Persist removes the TTL of key and reports whether it had one
+func (tx *Tx) Persist(key string) bool {
+	if _, ok := tx.s.clock.expiry[key]; !ok || !tx.s.writable(key) {
+		return false
+	}
+	tx.saveExpiry(key)
+	tx.s.clock.setExpiry(key, nil)
+	return true
+}
+
+// TTL returns the game time left before key expires and false if it has no TTL
+func (tx *Tx) TTL(key string) (float64, bool) {
+	return tx.s.ttl(key)
+}
+
+// SetWithTTL stores an int, int64, float64, bool or string value that
+// expires after ttl units of game time
+func (tx *Tx) SetWithTTL(key string, val any, ttl float64) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	var err error
+	switch v := val.(type) {
+	case int:
+		err = tx.SetInt(key, int64(v))
+	case int64:
+		err = tx.SetInt(key, v)
+	case float64:
+		err = tx.SetFloat(key, v)
+	case bool:
+		err = tx.SetBool(key, v)
+	case string:
+		err = tx.SetString(key, v)
+	default:
+		return fmt.Errorf("store: unsupported value type %T", val)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.setTTL(key, ttl)
+}
+
+// ---- Store ----
+
+// ttl returns the time left before key expires; s.mu must be held
+func (s *Store) ttl(key string) (float64, bool) {
+	at, ok := s.clock.expiry[key]
+	if !ok {
+		return 0, false
+	}
+	return at - s.clock.now, true
+}
+
+// SetWithTTL stores an int, int64, float64, bool or string value that
+// expires after ttl units of game time
+func (s *Store) SetWithTTL(key string, val any, ttl float64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.SetWithTTL(key, val, ttl)
+	})
+}
+
+// SetTTL makes an existing key expire after ttl units of game time
+func (s *Store) SetTTL(key string, ttl float64) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.setTTL(key, ttl)
+	})
+}
+
+// Persist removes the TTL of key and reports whether it had one. Read-only
+// keys keep their TTL and return ErrReadOnly.
+func (s *Store) Persist(key string) (bool, error) {
+	ok := false
+	err := s.Update(func(tx *Tx) error {
+		if !tx.s.writable(key) {
+			return fmt.Errorf("%w: %s", ErrReadOnly, key)
+		}
+		ok = tx.Persist(key)
+		return nil
+	})
+	return ok, err
+}
+
+// TTL returns the game time left before key expires and false if it has no TTL
+func (s *Store) TTL(key string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ttl(key)
+}
+
+// Advance moves the game clock forward by dt unless it is paused, removes
+// the keys whose time ran out and returns them sorted. Watchers see the
+// removals as changes with a nil New.
+func (s *Store) Advance(dt float64) []string {
+	var expired []string
+	var changes []Change
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.clock.paused || dt <= 0 {
+			return
+		}
+		s.clock.now += dt
+		for key, at := range s.clock.expiry {
+			if at <= s.clock.now {
+				expired = append(expired, key)
+			}
+		}
+		sort.Strings(expired)
+		for _, key := range expired {
+			delete(s.clock.expiry, key)
+			n := s.getNode(key)
+			if n == nil || n.entry == nil {
+				continue
+			}
+			old := *n.entry
+			s.removeEntry(key)
+			s.invalidate(key)
+			changes = append(changes, newChange(key, &old, nil))
+		}
+	}()
+	s.notify(changes)
+	return expired
+}
+
+// Now returns the game clock
+func (s *Store) Now() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock.now
+}
+
+// SetPaused stops or resumes the game clock
+func (s *Store) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock.paused = paused
+}
+
+func (s *Store) Paused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock.paused
+}
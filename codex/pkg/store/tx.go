@@ -0,0 +1,204 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrInsufficient is returned when a subtraction would take a value below
+// the amount being spent
+var ErrInsufficient = errors.New("store: insufficient value")
+
+// Tx reads and writes several keys atomically inside Update. It must not be
+// used after Update returns, and the function running it must not call
+// methods on the Store itself.
+type Tx struct {
+	s      *Store
+	old    map[string]*StoreEntry // entry each written key had before the transaction
+	expiry map[string]*float64    // expiry each key whose TTL changed had before
+	err    error                  // first write the schema rejected
+}
+
+// Update runs fn with the store locked. If fn returns an error or makes a
+// write the schema rejects, every write it made is undone and the error is
+// returned. If fn panics, its writes are undone and the panic continues once
+// the lock is released. Otherwise watchers are notified of the changes after
+// the lock is released.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	var changes []Change
+	err := func() (err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		tx := &Tx{s: s, old: make(map[string]*StoreEntry), expiry: make(map[string]*float64)}
+		committed := false
+		defer func() {
+			if !committed {
+				tx.rollback()
+			}
+		}()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if tx.err != nil {
+			return tx.err
+		}
+		committed = true
+		changes = tx.changes()
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	s.notify(changes)
+	return nil
+}
+
+func (tx *Tx) GetInt(key string) int64 {
+	return tx.s.getInt(key)
+}
+
+func (tx *Tx) GetFloat(key string) float64 {
+	return tx.s.getFloat(key)
+}
+
+func (tx *Tx) GetBool(key string) bool {
+	return tx.s.getBool(key)
+}
+
+func (tx *Tx) GetString(key string) string {
+	return tx.s.getString(key)
+}
+
+func (tx *Tx) SetInt(key string, val int64) error {
+	return tx.set(key, StoreEntry{Type: IntType, Value: val})
+}
+
+func (tx *Tx) SetFloat(key string, val float64) error {
+	return tx.set(key, StoreEntry{Type: FloatType, Value: math.Round(val*100) / 100})
+}
+
+func (tx *Tx) SetBool(key string, val bool) error {
+	return tx.set(key, StoreEntry{Type: BoolType, Value: val})
+}
+
+func (tx *Tx) SetString(key, val string) error {
+	return tx.set(key, StoreEntry{Type: StringType, Value: val})
+}
+
+func (tx *Tx) AddInt(key string, val int64) error {
+	return tx.SetInt(key, tx.GetInt(key)+val)
+}
+
+// SubInt subtracts val unless the current value is less than val
+func (tx *Tx) SubInt(key string, val int64) bool {
+	return tx.subInt(key, val) == nil
+}
+
+// subInt is SubInt returning why nothing was subtracted
+func (tx *Tx) subInt(key string, val int64) error {
+	current := tx.GetInt(key)
+	if current < val {
+		return fmt.Errorf("%w: %s", ErrInsufficient, key)
+	}
+	return tx.SetInt(key, current-val)
+}
+
+func (tx *Tx) AddFloat(key string, val float64) error {
+	return tx.SetFloat(key, tx.GetFloat(key)+val)
+}
+
+// SubFloat subtracts val unless the current value is less than val
+func (tx *Tx) SubFloat(key string, val float64) bool {
+	return tx.subFloat(key, val) == nil
+}
+
+// subFloat is SubFloat returning why nothing was subtracted
+func (tx *Tx) subFloat(key string, val float64) error {
+	current := tx.GetFloat(key)
+	if current < val {
+		return fmt.Errorf("%w: %s", ErrInsufficient, key)
+	}
+	return tx.SetFloat(key, current-val)
+}
+
+// set writes an entry, remembering what the key held before its first write.
+// Writes the schema rejects are skipped and fail the transaction.
+func (tx *Tx) set(key string, e StoreEntry) error {
+	if err := tx.s.applySchema(key, &e); err != nil {
+		if tx.err == nil {
+			tx.err = err
+		}
+		return err
+	}
+	n := tx.s.getOrCreateNode(key)
+	if _, seen := tx.old[key]; !seen {
+		var prev *StoreEntry
+		if n.entry != nil {
+			p := *n.entry
+			prev = &p
+		}
+		tx.old[key] = prev
+	}
+	n.entry = &e
+	tx.s.invalidate(key)
+	return nil
+}
+
+// rollback restores every written key, removing keys the transaction created
+func (tx *Tx) rollback() {
+	for key, prev := range tx.old {
+		if prev == nil {
+			tx.s.removeEntry(key)
+			continue
+		}
+		tx.s.getOrCreateNode(key).entry = prev
+	}
+	for key, prev := range tx.expiry {
+		tx.s.clock.setExpiry(key, prev)
+	}
+	tx.s.invalidateAll()
+}
+
+// removeEntry deletes the value at key and prunes the nodes it leaves empty;
+// s.mu must be held
+func (s *Store) removeEntry(key string) {
+	parts := strings.Split(key, ".")
+	path := make([]*node, 0, len(parts)+1)
+	cur := s.root
+	path = append(path, cur)
+	for _, p := range parts {
+		cur = cur.children[p]
+		if cur == nil {
+			return
+		}
+		path = append(path, cur)
+	}
+	cur.entry = nil
+
+	for i := len(parts); i > 0; i-- {
+		n := path[i]
+		if n.entry != nil || len(n.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, parts[i-1])
+	}
+}
+
+// changes returns the keys whose values differ from before the transaction
+func (tx *Tx) changes() []Change {
+	var changes []Change
+	for key, prev := range tx.old {
+		cur := tx.s.getNode(key).entry
+		if prev != nil && sameEntry(*prev, *cur) {
+			continue
+		}
+		changes = append(changes, newChange(key, prev, cur))
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
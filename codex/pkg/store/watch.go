@@ -0,0 +1,189 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Change describes a key whose value changed. Old is nil when the key was
+// created and New is nil when it was removed.
+type Change struct {
+	Key string
+	Old *StoreEntry
+	New *StoreEntry
+}
+
+// WatchFunc is called after a watched key changes, outside the store lock
+type WatchFunc func(Change)
+
+type watcher struct {
+	prefix string
+	fn     WatchFunc
+}
+
+// maxQueuedChanges bounds each subscription queue; the oldest changes are
+// dropped first
+const maxQueuedChanges = 256
+
+type watchState struct {
+	mu       sync.Mutex
+	next     int
+	watchers map[int]watcher
+	queues   map[int][]Change
+}
+
+// watchState returns the store's watchers, creating their maps on first use
+func (s *Store) watchState() *watchState {
+	ws := &s.watch
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.watchers == nil {
+		ws.next = 1
+		ws.watchers = make(map[int]watcher)
+		ws.queues = make(map[int][]Change)
+	}
+	return ws
+}
+
+// Watch calls fn for every change of a key equal to or under prefix made by
+// Set, Add, Sub, Clear or Load. Writes that leave a value unchanged are not
+// reported. An empty prefix watches every key. Returns the watcher ID.
+func (s *Store) Watch(prefix string, fn WatchFunc) int {
+	ws := s.watchState()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	id := ws.next
+	ws.next++
+	ws.watchers[id] = watcher{prefix: prefix, fn: fn}
+	return id
+}
+
+// Unwatch removes a watcher or subscription
+func (s *Store) Unwatch(id int) bool {
+	ws := s.watchState()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, ok := ws.watchers[id]; !ok {
+		return false
+	}
+	delete(ws.watchers, id)
+	delete(ws.queues, id)
+	return true
+}
+
+// Subscribe queues changes under prefix until they are polled and returns
+// the subscription ID
+func (s *Store) Subscribe(prefix string) int {
+	ws := s.watchState()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	id := ws.next
+	ws.next++
+	ws.watchers[id] = watcher{prefix: prefix, fn: func(c Change) {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		if _, ok := ws.watchers[id]; !ok {
+			return
+		}
+		q := append(ws.queues[id], c)
+		if over := len(q) - maxQueuedChanges; over > 0 {
+			q = q[over:]
+		}
+		ws.queues[id] = q
+	}}
+	return id
+}
+
+// PollChange pops the oldest queued change of a subscription
+func (s *Store) PollChange(id int) (Change, bool) {
+	ws := s.watchState()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	q := ws.queues[id]
+	if len(q) == 0 {
+		return Change{}, false
+	}
+	c := q[0]
+	ws.queues[id] = q[1:]
+	return c, true
+}
+
+// notify hands changes to matching watchers; s.mu must not be held
+func (s *Store) notify(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	ws := s.watchState()
+	ws.mu.Lock()
+	ids := make([]int, 0, len(ws.watchers))
+	for id := range ws.watchers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	targets := make([]watcher, 0, len(ids))
+	for _, id := range ids {
+		targets = append(targets, ws.watchers[id])
+	}
+	ws.mu.Unlock()
+
+	for _, c := range changes {
+		for _, w := range targets {
+			if underPrefix(c.Key, w.prefix) {
+				w.fn(c)
+			}
+		}
+	}
+}
+
+// underPrefix reports whether key is prefix or one of its subkeys
+func underPrefix(key, prefix string) bool {
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
+// newChange returns the change from old to new. Both are copied so later
+// writes can't alter a reported change.
+func newChange(key string, old, cur *StoreEntry) Change {
+	c := Change{Key: key}
+	if old != nil {
+		o := *old
+		c.Old = &o
+	}
+	if cur != nil {
+		n := *cur
+		c.New = &n
+	}
+	return c
+}
+
+// sameEntry reports whether two entries hold the same typed value
+func sameEntry(a, b StoreEntry) bool {
+	return a.Type == b.Type && reflect.DeepEqual(a.Value, b.Value)
+}
+
+// diffEntries returns the changes between two flattened stores, sorted by key
+func diffEntries(before, after map[string]StoreEntry) []Change {
+	var changes []Change
+	for key, old := range before {
+		old := old
+		if cur, ok := after[key]; ok {
+			if sameEntry(cur, old) {
+				continue
+			}
+			cur := cur
+			changes = append(changes, newChange(key, &old, &cur))
+			continue
+		}
+		changes = append(changes, newChange(key, &old, nil))
+	}
+	for key, cur := range after {
+		if _, ok := before[key]; ok {
+			continue
+		}
+		cur := cur
+		changes = append(changes, newChange(key, nil, &cur))
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}